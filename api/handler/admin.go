@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/rithikjain/SocialRecipe/api/middleware"
+	"github.com/rithikjain/SocialRecipe/api/view"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/auth"
+	"github.com/rithikjain/SocialRecipe/pkg/recipe"
+	"github.com/rithikjain/SocialRecipe/pkg/user"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Admin Request
+func listUsers(svc user.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		_, err := middleware.ValidateAndGetClaims(r.Context(), "admin")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		query := strings.ToLower(r.URL.Query().Get("query"))
+		var pageNo = 1
+		pageNoStr := r.URL.Query().Get("page")
+		if pageNoStr != "" {
+			pageNo, _ = strconv.Atoi(pageNoStr)
+		}
+
+		page, err := svc.ListUsers(query, pageNo)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		hasNextPage := true
+		if page.Page >= page.TotalPage {
+			hasNextPage = false
+		}
+
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":       "Users fetched",
+			"users":         page.Records,
+			"page":          page.Page,
+			"has_next_page": hasNextPage,
+			"total_pages":   page.TotalPage,
+		})
+	})
+}
+
+// Admin Request
+func suspendUser(svc user.Service, authSvc auth.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "admin")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		userIDStr := r.URL.Query().Get("user_id")
+		if userIDStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		userID, _ := strconv.Atoi(userIDStr)
+		if uint(userID) == uint(claims["id"].(float64)) {
+			view.Wrap(pkg.ErrForbidden, w)
+			return
+		}
+
+		err = svc.SuspendUser(uint(userID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		err = authSvc.LogoutAll(uint(userID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "User suspended",
+		})
+	})
+}
+
+// Admin Request
+func unsuspendUser(svc user.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		_, err := middleware.ValidateAndGetClaims(r.Context(), "admin")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		userIDStr := r.URL.Query().Get("user_id")
+		if userIDStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		userID, _ := strconv.Atoi(userIDStr)
+
+		err = svc.UnsuspendUser(uint(userID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "User unsuspended",
+		})
+	})
+}
+
+// Admin Request
+func unlockLogin(svc user.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		_, err := middleware.ValidateAndGetClaims(r.Context(), "admin")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		userIDStr := r.URL.Query().Get("user_id")
+		if userIDStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		userID, _ := strconv.Atoi(userIDStr)
+
+		err = svc.UnlockLogin(uint(userID), r.URL.Query().Get("ip"))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "User unlocked",
+		})
+	})
+}
+
+// Admin Request
+func resetProfileImage(svc user.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		_, err := middleware.ValidateAndGetClaims(r.Context(), "admin")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		userIDStr := r.URL.Query().Get("user_id")
+		if userIDStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		userID, _ := strconv.Atoi(userIDStr)
+
+		u, err := svc.GetUserByID(uint(userID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if u.ProfileImgPublicID != "" {
+			err = destroyImage(u.ProfileImgPublicID)
+			if err != nil {
+				view.Wrap(err, w)
+				return
+			}
+		}
+
+		us, err := svc.ResetProfileImage(u.ID)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		us.Password = ""
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Profile image reset",
+			"user":    us,
+		})
+	})
+}
+
+// Admin Request
+func forceDeleteRecipe(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		_, err := middleware.ValidateAndGetClaims(r.Context(), "admin")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		recipeIDStr := r.URL.Query().Get("recipe_id")
+		if recipeIDStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		recipeID, _ := strconv.Atoi(recipeIDStr)
+		rec, err := svc.FindRecipeByID(uint(recipeID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		err = svc.DeleteRecipe(rec.ID)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Recipe deleted",
+		})
+	})
+}
+
+func MakeAdminHandler(r *http.ServeMux, userSvc user.Service, recipeSvc recipe.Service, authSvc auth.Service) {
+	r.Handle("/api/v1/admin/users", middleware.Validate(listUsers(userSvc)))
+	r.Handle("/api/v1/admin/users/suspend", middleware.Validate(suspendUser(userSvc, authSvc)))
+	r.Handle("/api/v1/admin/users/unsuspend", middleware.Validate(unsuspendUser(userSvc)))
+	r.Handle("/api/v1/admin/users/unlock", middleware.Validate(unlockLogin(userSvc)))
+	r.Handle("/api/v1/admin/users/resetimage", middleware.Validate(resetProfileImage(userSvc)))
+	r.Handle("/api/v1/admin/recipe/delete", middleware.Validate(forceDeleteRecipe(recipeSvc)))
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/rithikjain/SocialRecipe/api/view"
+	"github.com/rithikjain/SocialRecipe/pkg/auth"
+	"net/http"
+)
+
+// Public keys for services that verify our access tokens themselves
+func jwks(svc auth.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		w.Header().Add("Cache-Control", "public, max-age=300")
+		_ = json.NewEncoder(w).Encode(svc.JWKS())
+	})
+}
+
+func MakeAuthHandler(r *http.ServeMux, svc auth.Service) {
+	r.Handle("/.well-known/jwks.json", jwks(svc))
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/rithikjain/SocialRecipe/api/middleware"
+	"github.com/rithikjain/SocialRecipe/api/view"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/export"
+	"net/http"
+	"strconv"
+)
+
+// Protected Request
+func requestExport(svc export.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		exp, err := svc.RequestExport(uint(claims["id"].(float64)))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Export requested",
+			"export":  exp,
+		})
+	})
+}
+
+// Protected Request
+func exportStatus(svc export.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		exportIDStr := r.URL.Query().Get("export_id")
+		if exportIDStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		exportID, _ := strconv.Atoi(exportIDStr)
+
+		exp, err := svc.GetExport(uint(exportID), uint(claims["id"].(float64)))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Export fetched",
+			"export":  exp,
+		})
+	})
+}
+
+// Protected Request
+func downloadExport(svc export.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		exportIDStr := r.URL.Query().Get("export_id")
+		if exportIDStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		exportID, _ := strconv.Atoi(exportIDStr)
+
+		path, err := svc.GetArchivePath(uint(exportID), uint(claims["id"].(float64)))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/zip")
+		w.Header().Add("Content-Disposition", fmt.Sprintf(`attachment; filename="cookssocial-export-%d.zip"`, exportID))
+		http.ServeFile(w, r, path)
+	})
+}
+
+func MakeExportHandler(r *http.ServeMux, svc export.Service) {
+	r.Handle("/api/v1/user/export", middleware.Validate(requestExport(svc)))
+	r.Handle("/api/v1/user/export/status", middleware.Validate(exportStatus(svc)))
+	r.Handle("/api/v1/user/export/download", middleware.Validate(downloadExport(svc)))
+}
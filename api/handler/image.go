@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/rithikjain/SocialRecipe/api/middleware"
+	"github.com/rithikjain/SocialRecipe/api/view"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"github.com/rithikjain/SocialRecipe/pkg/recipe"
+	"net/http"
+	"strconv"
+)
+
+// Protected Request
+func addImage(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		_ = r.ParseMultipartForm(10 << 20)
+		_ = r.ParseForm()
+
+		recipeID, _ := strconv.Atoi(r.FormValue("recipe_id"))
+		rec, err := svc.FindRecipeByID(uint(recipeID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if rec.UserID != userID {
+			view.Wrap(pkg.ErrUnauthorized, w)
+			return
+		}
+
+		// Images go to the end unless a position is given
+		position := -1
+		if positionStr := r.FormValue("position"); positionStr != "" {
+			position, _ = strconv.Atoi(positionStr)
+		}
+		cover, _ := strconv.ParseBool(r.FormValue("cover"))
+		image := &entities.RecipeImage{
+			RecipeID: rec.ID,
+			Position: position,
+			AltText:  r.FormValue("alt_text"),
+			Cover:    cover,
+		}
+		stored, err := uploadImage(r, "image")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		image.ImgUrl = stored.URL
+		image.ImgPublicId = stored.ID
+		image.ImgVariants = stored.Variants
+
+		images, err := svc.AddImage(image)
+		if err != nil {
+			_ = destroyImage(stored.ID)
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Image added",
+			"images":  images,
+		})
+	})
+}
+
+// Protected Request
+func updateImage(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		type Update struct {
+			RecipeID uint   `json:"recipe_id"`
+			ImageID  uint   `json:"image_id"`
+			AltText  string `json:"alt_text"`
+			Cover    bool   `json:"cover"`
+		}
+		var body Update
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		rec, err := svc.FindRecipeByID(body.RecipeID)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if rec.UserID != userID {
+			view.Wrap(pkg.ErrUnauthorized, w)
+			return
+		}
+
+		image := &entities.RecipeImage{
+			RecipeID: rec.ID,
+			AltText:  body.AltText,
+			Cover:    body.Cover,
+		}
+		image.ID = body.ImageID
+		images, err := svc.UpdateImage(image)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Image updated",
+			"images":  images,
+		})
+	})
+}
+
+// Protected Request
+func deleteImage(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		recipeIDStr := r.URL.Query().Get("recipe_id")
+		imageIDStr := r.URL.Query().Get("image_id")
+		if recipeIDStr == "" || imageIDStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		recipeID, _ := strconv.Atoi(recipeIDStr)
+		imageID, _ := strconv.Atoi(imageIDStr)
+		rec, err := svc.FindRecipeByID(uint(recipeID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if rec.UserID != userID {
+			view.Wrap(pkg.ErrUnauthorized, w)
+			return
+		}
+
+		images, err := svc.DeleteImage(rec.ID, uint(imageID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Image deleted",
+			"images":  images,
+		})
+	})
+}
+
+// Protected Request
+func reorderImages(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		type Reorder struct {
+			RecipeID uint   `json:"recipe_id"`
+			ImageIDs []uint `json:"image_ids"`
+		}
+		var body Reorder
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		rec, err := svc.FindRecipeByID(body.RecipeID)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if rec.UserID != userID {
+			view.Wrap(pkg.ErrUnauthorized, w)
+			return
+		}
+
+		images, err := svc.ReorderImages(rec.ID, body.ImageIDs)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Images reordered",
+			"images":  images,
+		})
+	})
+}
+
+func MakeImageHandler(r *http.ServeMux, svc recipe.Service) {
+	r.Handle("/api/v1/recipe/image/add", middleware.Validate(addImage(svc)))
+	r.Handle("/api/v1/recipe/image/update", middleware.Validate(updateImage(svc)))
+	r.Handle("/api/v1/recipe/image/delete", middleware.Validate(deleteImage(svc)))
+	r.Handle("/api/v1/recipe/image/reorder", middleware.Validate(reorderImages(svc)))
+}
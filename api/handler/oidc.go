@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/rithikjain/SocialRecipe/api/view"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/auth"
+	"github.com/rithikjain/SocialRecipe/pkg/oidc"
+	"github.com/rithikjain/SocialRecipe/pkg/user"
+	"net/http"
+)
+
+func listProviders(svc oidc.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "Providers fetched",
+			"providers": svc.Providers(),
+		})
+	})
+}
+
+// The client sends the user to authorization_url, the provider sends them
+// back to the redirect url of the client with a code and the state.
+func startProviderLogin(svc oidc.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		provider := r.URL.Query().Get("provider")
+		if provider == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		authURL, err := svc.AuthorizationURL(provider)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":           "Login started",
+			"authorization_url": authURL,
+		})
+	})
+}
+
+func finishProviderLogin(svc oidc.Service, userSvc user.Service, authSvc auth.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		type Callback struct {
+			State string `json:"state"`
+			Code  string `json:"code"`
+		}
+		var body Callback
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		identity, err := svc.Exchange(body.State, body.Code)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		u, err := userSvc.LoginWithIdentity(identity)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		if u.TwoFactorEnabled {
+			challenge, err := authSvc.IssueChallenge(u)
+			if err != nil {
+				view.Wrap(err, w)
+				return
+			}
+			w.Header().Add("Content-Type", "application/json; charset=utf-8")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":             "Two factor authentication required",
+				"two_factor_required": true,
+				"challenge_token":     challenge,
+			})
+			return
+		}
+
+		tokens, err := authSvc.IssueTokens(u)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		u.Password = ""
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":       "Login Successful",
+			"token":         tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"expires_at":    tokens.ExpiresAt,
+			"user":          u,
+		})
+	})
+}
+
+func MakeOIDCHandler(r *http.ServeMux, svc oidc.Service, userSvc user.Service, authSvc auth.Service) {
+	r.Handle("/api/v1/user/oidc/providers", listProviders(svc))
+	r.Handle("/api/v1/user/oidc/start", startProviderLogin(svc))
+	r.Handle("/api/v1/user/oidc/callback", finishProviderLogin(svc, userSvc, authSvc))
+}
@@ -1,20 +1,17 @@
 package handler
 
 import (
-	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"github.com/rithikjain/SocialRecipe/api/middleware"
 	"github.com/rithikjain/SocialRecipe/api/view"
 	"github.com/rithikjain/SocialRecipe/pkg"
 	"github.com/rithikjain/SocialRecipe/pkg/entities"
 	"github.com/rithikjain/SocialRecipe/pkg/recipe"
-	"io/ioutil"
+	"github.com/rithikjain/SocialRecipe/pkg/user"
 	"net/http"
-	"net/url"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Protected Request
@@ -33,69 +30,102 @@ func createRecipe(svc recipe.Service) http.Handler {
 		}
 		userID := uint(claims["id"].(float64))
 
+		us, err := svc.FindUserByID(userID)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if err := user.CheckVerified(us); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
 		_ = r.ParseMultipartForm(10 << 20)
 		_ = r.ParseForm()
 
-		file, handler, err := r.FormFile("image")
+		ingredients, err := decodeIngredients(r.FormValue("ingredients"))
 		if err != nil {
-			view.Wrap(view.ErrFile, w)
+			view.Wrap(err, w)
 			return
 		}
-		defer file.Close()
-		fileBytes, err := ioutil.ReadAll(file)
+		steps, err := decodeSteps(r)
 		if err != nil {
-			view.Wrap(view.ErrFile, w)
+			view.Wrap(err, w)
+			return
 		}
-		imgBase64 := base64.StdEncoding.EncodeToString(fileBytes)
-
-		imgUrl := format(imgBase64, handler.Header.Get("Content-Type"))
-
-		// Uploading the image on cloudinary
-		form := url.Values{}
-		form.Add("file", imgUrl)
-		form.Add("upload_preset", os.Getenv("uploadPreset"))
-
-		response, err := http.PostForm(os.Getenv("cloudinaryUrl"), form)
+		tags, err := decodeTags(r.FormValue("tags"))
 		if err != nil {
-			view.Wrap(view.ErrFile, w)
+			view.Wrap(err, w)
 			return
 		}
-		defer response.Body.Close()
-
-		var resJson map[string]interface{}
-		err = json.NewDecoder(response.Body).Decode(&resJson)
+		addedLabels, err := decodeLabels(r.FormValue("added_labels"))
 		if err != nil {
-			view.Wrap(view.ErrUpload, w)
+			view.Wrap(err, w)
 			return
 		}
-
-		if response.StatusCode != http.StatusOK {
-			view.Wrap(view.ErrUpload, w)
+		removedLabels, err := decodeLabels(r.FormValue("removed_labels"))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		prepTime, err := parseDuration(r.FormValue("prep_time"))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		cookTime, err := parseDuration(r.FormValue("cook_time"))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		restTime, err := parseDuration(r.FormValue("rest_time"))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		publishAt, err := parsePublishAt(r.FormValue("publish_at"))
+		if err != nil {
+			view.Wrap(err, w)
 			return
 		}
 
-		us, err := svc.FindUserByID(userID)
+		stored, err := uploadImage(r, "image")
 		if err != nil {
 			view.Wrap(err, w)
 			return
 		}
 
 		difficulty, _ := strconv.Atoi(r.FormValue("difficulty"))
+		servings, _ := strconv.Atoi(r.FormValue("servings"))
 		recipe := &entities.Recipe{
-			UserID:      userID,
-			RecipeName:  r.FormValue("recipe_name"),
-			Description: r.FormValue("description"),
-			Ingredients: r.FormValue("ingredients"),
-			Difficulty:  difficulty,
-			Procedure:   r.FormValue("procedure"),
-			ImgUrl:      resJson["secure_url"].(string),
-			ImgPublicId: resJson["public_id"].(string),
-			Name:        us.Name,
-			Username:    us.Username,
-			UserImg:     us.ProfileImgUrl,
+			UserID:        userID,
+			RecipeName:    r.FormValue("recipe_name"),
+			Description:   r.FormValue("description"),
+			Ingredients:   ingredients,
+			Difficulty:    difficulty,
+			Servings:      servings,
+			PrepTime:      prepTime,
+			CookTime:      cookTime,
+			RestTime:      restTime,
+			Steps:         steps,
+			Tags:          tags,
+			AddedLabels:   addedLabels,
+			RemovedLabels: removedLabels,
+			Visibility:    strings.ToLower(strings.TrimSpace(r.FormValue("visibility"))),
+			PublishAt:     publishAt,
+			Images: []entities.RecipeImage{{
+				ImgUrl:      stored.URL,
+				ImgPublicId: stored.ID,
+				ImgVariants: stored.Variants,
+				AltText:     r.FormValue("image_alt"),
+			}},
+			Name:     us.Name,
+			Username: us.Username,
+			UserImg:  us.ProfileImgUrl,
 		}
 		rec, err := svc.CreateRecipe(recipe)
 		if err != nil {
+			_ = destroyImage(stored.ID)
 			view.Wrap(err, w)
 			return
 		}
@@ -126,66 +156,129 @@ func updateRecipe(svc recipe.Service) http.Handler {
 		_ = r.ParseMultipartForm(10 << 20)
 		_ = r.ParseForm()
 
-		file, handler, err := r.FormFile("image")
+		ingredients, err := decodeIngredients(r.FormValue("ingredients"))
 		if err != nil {
-			view.Wrap(view.ErrFile, w)
+			view.Wrap(err, w)
 			return
 		}
-		defer file.Close()
-		fileBytes, err := ioutil.ReadAll(file)
+		steps, err := decodeSteps(r)
 		if err != nil {
-			view.Wrap(view.ErrFile, w)
+			view.Wrap(err, w)
+			return
 		}
-		imgBase64 := base64.StdEncoding.EncodeToString(fileBytes)
-
-		imgUrl := format(imgBase64, handler.Header.Get("Content-Type"))
-
-		// Uploading the image on cloudinary
-		form := url.Values{}
-		form.Add("file", imgUrl)
-		form.Add("upload_preset", os.Getenv("uploadPreset"))
-
-		response, err := http.PostForm(os.Getenv("cloudinaryUrl"), form)
+		tags, err := decodeTags(r.FormValue("tags"))
 		if err != nil {
-			view.Wrap(view.ErrFile, w)
+			view.Wrap(err, w)
 			return
 		}
-		defer response.Body.Close()
-
-		var resJson map[string]interface{}
-		err = json.NewDecoder(response.Body).Decode(&resJson)
+		addedLabels, err := decodeLabels(r.FormValue("added_labels"))
 		if err != nil {
-			view.Wrap(view.ErrUpload, w)
+			view.Wrap(err, w)
 			return
 		}
-
-		if response.StatusCode != http.StatusOK {
-			view.Wrap(view.ErrUpload, w)
+		removedLabels, err := decodeLabels(r.FormValue("removed_labels"))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		prepTime, err := parseDuration(r.FormValue("prep_time"))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		cookTime, err := parseDuration(r.FormValue("cook_time"))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		restTime, err := parseDuration(r.FormValue("rest_time"))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		publishAt, err := parsePublishAt(r.FormValue("publish_at"))
+		if err != nil {
+			view.Wrap(err, w)
 			return
 		}
 
 		difficulty, _ := strconv.Atoi(r.FormValue("difficulty"))
+		servings, _ := strconv.Atoi(r.FormValue("servings"))
 		id, _ := strconv.ParseUint(r.FormValue("recipe_id"), 10, 32)
 		rec, err := svc.FindRecipeByID(uint(id))
 		if err != nil {
 			view.Wrap(err, w)
 			return
 		}
+		if rec.UserID != userID {
+			view.Wrap(pkg.ErrUnauthorized, w)
+			return
+		}
+
+		// The image is optional, a new one replaces the cover. It is only stored
+		// once the recipe is known to be the user's, and removed again on failure
+		var cover *entities.RecipeImage
+		if r.MultipartForm != nil && len(r.MultipartForm.File["image"]) > 0 {
+			stored, err := uploadImage(r, "image")
+			if err != nil {
+				view.Wrap(err, w)
+				return
+			}
+			cover = &entities.RecipeImage{
+				ImgUrl:      stored.URL,
+				ImgPublicId: stored.ID,
+				ImgVariants: stored.Variants,
+				AltText:     r.FormValue("image_alt"),
+			}
+		}
+
 		rec.ID = uint(id)
-		rec.UserID = userID
 		rec.RecipeName = r.FormValue("recipe_name")
 		rec.Description = r.FormValue("description")
-		rec.Ingredients = r.FormValue("ingredients")
+		rec.Ingredients = ingredients
 		rec.Difficulty = difficulty
-		rec.Procedure = r.FormValue("procedure")
-		rec.ImgUrl = resJson["secure_url"].(string)
-		rec.ImgPublicId = resJson["public_id"].(string)
+		rec.Servings = servings
+		rec.PrepTime = prepTime
+		rec.CookTime = cookTime
+		rec.RestTime = restTime
+		// Steps are left as they are when a client sends neither
+		_, hasSteps := r.Form["steps"]
+		_, hasProcedure := r.Form["procedure"]
+		if hasSteps || hasProcedure {
+			rec.Steps = steps
+		}
+		rec.Tags = tags
+		rec.AddedLabels = addedLabels
+		rec.RemovedLabels = removedLabels
+		// Visibility and the publish time are left as they are unless sent,
+		// an empty publish time cancels the scheduled one
+		if _, ok := r.Form["visibility"]; ok {
+			rec.Visibility = strings.ToLower(strings.TrimSpace(r.FormValue("visibility")))
+		}
+		if _, ok := r.Form["publish_at"]; ok {
+			rec.PublishAt = publishAt
+		}
 
 		re, err := svc.UpdateRecipe(rec)
 		if err != nil {
+			if cover != nil {
+				_ = destroyImage(cover.ImgPublicId)
+			}
 			view.Wrap(err, w)
 			return
 		}
+		if cover != nil {
+			cover.RecipeID = rec.ID
+			if _, err := svc.ReplaceCoverImage(cover); err != nil {
+				_ = destroyImage(cover.ImgPublicId)
+				view.Wrap(err, w)
+				return
+			}
+			if re, err = svc.FindRecipeByID(rec.ID); err != nil {
+				view.Wrap(err, w)
+				return
+			}
+		}
 		w.Header().Add("Content-Type", "application/json; charset=utf-8")
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
 			"message": "Recipe updated",
@@ -226,33 +319,60 @@ func deleteRecipe(svc recipe.Service) http.Handler {
 			return
 		}
 
-		req, err := http.NewRequest("DELETE", os.Getenv("cloudinaryDeleteUrl"), nil)
+		err = svc.DeleteRecipe(uint(recipeID))
 		if err != nil {
 			view.Wrap(err, w)
 			return
 		}
-		q := req.URL.Query()
-		q.Add("public_ids", rec.ImgPublicId)
-		req.URL.RawQuery = q.Encode()
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Recipe deleted",
+		})
+	})
+}
+
+// Protected Request
+func showRecipe(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
 
-		client := &http.Client{}
-		res, err := client.Do(req)
+		// Get user id from claims
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
 		if err != nil {
 			view.Wrap(err, w)
 			return
 		}
-		if res.StatusCode != http.StatusOK {
-			view.Wrap(view.ErrFile, w)
+		viewerID := uint(claims["id"].(float64))
+
+		recipeIDStr := r.URL.Query().Get("recipe_id")
+		if recipeIDStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
 			return
 		}
-		err = svc.DeleteRecipe(uint(recipeID))
+		recipeID, _ := strconv.Atoi(recipeIDStr)
+		rec, err := svc.FindVisibleRecipe(viewerID, uint(recipeID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		servings, units, err := scaleParams(r)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		rec, err = svc.ScaleRecipe(rec, servings, units)
 		if err != nil {
 			view.Wrap(err, w)
 			return
 		}
 		w.Header().Add("Content-Type", "application/json; charset=utf-8")
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"message": "Recipe deleted",
+			"message": "Recipe fetched",
+			"recipe":  rec,
 		})
 	})
 }
@@ -265,6 +385,14 @@ func showAllRecipesOfUser(svc recipe.Service) http.Handler {
 			return
 		}
 
+		// Get user id from claims
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		viewerID := uint(claims["id"].(float64))
+
 		userIDStr := r.URL.Query().Get("user_id")
 		userID, _ := strconv.Atoi(userIDStr)
 
@@ -274,11 +402,15 @@ func showAllRecipesOfUser(svc recipe.Service) http.Handler {
 			pageNo, _ = strconv.Atoi(pageNoStr)
 		}
 
-		page, err := svc.GetAllRecipesOfUser(uint(userID), pageNo)
+		page, err := svc.GetAllRecipesOfUser(uint(userID), viewerID, pageNo)
 		if err != nil {
 			view.Wrap(err, w)
 			return
 		}
+		if err := scaleRecipes(svc, r, page.Records); err != nil {
+			view.Wrap(err, w)
+			return
+		}
 
 		hasNextPage := true
 		if page.Page >= page.TotalPage {
@@ -318,11 +450,15 @@ func showMyRecipes(svc recipe.Service) http.Handler {
 			pageNo, _ = strconv.Atoi(pageNoStr)
 		}
 
-		page, err := svc.GetAllRecipesOfUser(userID, pageNo)
+		page, err := svc.GetAllRecipesOfUser(userID, userID, pageNo)
 		if err != nil {
 			view.Wrap(err, w)
 			return
 		}
+		if err := scaleRecipes(svc, r, page.Records); err != nil {
+			view.Wrap(err, w)
+			return
+		}
 
 		hasNextPage := true
 		if page.Page >= page.TotalPage {
@@ -366,6 +502,10 @@ func showMyFavRecipes(svc recipe.Service) http.Handler {
 			view.Wrap(err, w)
 			return
 		}
+		if err := scaleRecipes(svc, r, page.Records); err != nil {
+			view.Wrap(err, w)
+			return
+		}
 
 		hasNextPage := true
 		if page.Page >= page.TotalPage {
@@ -468,6 +608,13 @@ func showUsersWhoLiked(svc recipe.Service) http.Handler {
 			return
 		}
 
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		viewerID := uint(claims["id"].(float64))
+
 		recipeIDStr := r.URL.Query().Get("recipe_id")
 		recipeID, _ := strconv.Atoi(recipeIDStr)
 
@@ -477,7 +624,7 @@ func showUsersWhoLiked(svc recipe.Service) http.Handler {
 			pageNo, _ = strconv.Atoi(pageNoStr)
 		}
 
-		page, err := svc.ShowUsersWhoLiked(uint(recipeID), pageNo)
+		page, err := svc.ShowUsersWhoLiked(viewerID, uint(recipeID), pageNo)
 		if err != nil {
 			view.Wrap(err, w)
 			return
@@ -521,12 +668,22 @@ func showUserFeed(svc recipe.Service) http.Handler {
 			pageNo, _ = strconv.Atoi(pageNoStr)
 		}
 
-		page, err := svc.ShowUserFeed(userID, pageNo)
+		filter, err := listFilter(r)
 		if err != nil {
 			view.Wrap(err, w)
 			return
 		}
 
+		page, err := svc.ShowUserFeed(userID, filter, pageNo)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if err := scaleRecipes(svc, r, page.Records); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
 		hasNextPage := true
 		if page.Page >= page.TotalPage {
 			hasNextPage = false
@@ -551,18 +708,36 @@ func showAllLatestRecipes(svc recipe.Service) http.Handler {
 			return
 		}
 
+		// Get user id from claims
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
 		var pageNo = 1
 		pageNoStr := r.URL.Query().Get("page")
 		if pageNoStr != "" {
 			pageNo, _ = strconv.Atoi(pageNoStr)
 		}
 
-		page, err := svc.ShowAllLatestRecipes(pageNo)
+		filter, err := listFilter(r)
 		if err != nil {
 			view.Wrap(err, w)
 			return
 		}
 
+		page, err := svc.ShowAllLatestRecipes(userID, filter, pageNo)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if err := scaleRecipes(svc, r, page.Records); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
 		hasNextPage := true
 		if page.Page >= page.TotalPage {
 			hasNextPage = false
@@ -587,24 +762,41 @@ func searchRecipes(svc recipe.Service) http.Handler {
 			return
 		}
 
+		// Get user id from claims
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		viewerID := uint(claims["id"].(float64))
+
 		var pageNo = 1
 		pageNoStr := r.URL.Query().Get("page")
 		if pageNoStr != "" {
 			pageNo, _ = strconv.Atoi(pageNoStr)
 		}
 
-		query := r.URL.Query().Get("query")
-		if query == "" {
+		filter, err := listFilter(r)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		filter.Query = strings.ToLower(r.URL.Query().Get("query"))
+		filter.Tags = recipe.ParseTags(r.URL.Query().Get("tags"))
+		if filter.Query == "" && len(filter.Tags) == 0 {
 			view.Wrap(pkg.ErrNoContent, w)
 			return
 		}
-		query = strings.ToLower(query)
 
-		page, err := svc.SearchRecipes(query, pageNo)
+		page, err := svc.SearchRecipes(viewerID, filter, pageNo)
 		if err != nil {
 			view.Wrap(err, w)
 			return
 		}
+		if err := scaleRecipes(svc, r, page.Records); err != nil {
+			view.Wrap(err, w)
+			return
+		}
 
 		hasNextPage := true
 		if page.Page >= page.TotalPage {
@@ -622,20 +814,239 @@ func searchRecipes(svc recipe.Service) http.Handler {
 	})
 }
 
-func format(encStr string, mime string) string {
-	switch mime {
-	case "image/gif", "image/jpeg", "image/pjpeg", "image/png", "image/tiff":
-		return fmt.Sprintf("data:%s;base64,%s", mime, encStr)
-	default:
+// Protected Request
+func forkRecipe(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		// Get user id from claims
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		us, err := svc.FindUserByID(userID)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if err := user.CheckVerified(us); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		recipeIDStr := r.URL.Query().Get("recipe_id")
+		if recipeIDStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		recipeID, _ := strconv.Atoi(recipeIDStr)
+
+		rec, err := svc.ForkRecipe(userID, uint(recipeID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Recipe forked",
+			"recipe":  rec,
+		})
+	})
+}
+
+// Protected Request
+func showForks(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		// Get user id from claims
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		viewerID := uint(claims["id"].(float64))
+
+		recipeIDStr := r.URL.Query().Get("recipe_id")
+		recipeID, _ := strconv.Atoi(recipeIDStr)
+
+		var pageNo = 1
+		pageNoStr := r.URL.Query().Get("page")
+		if pageNoStr != "" {
+			pageNo, _ = strconv.Atoi(pageNoStr)
+		}
+
+		page, err := svc.ShowForks(viewerID, uint(recipeID), pageNo)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if err := scaleRecipes(svc, r, page.Records); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		hasNextPage := true
+		if page.Page >= page.TotalPage {
+			hasNextPage = false
+		}
+
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":       "Forks fetched",
+			"recipes":       page.Records,
+			"page":          page.Page,
+			"has_next_page": hasNextPage,
+			"total_pages":   page.TotalPage,
+		})
+	})
+}
+
+// The servings and units query parameters recipes can be fetched with
+func scaleParams(r *http.Request) (int, string, error) {
+	servings := 0
+	if servingsStr := r.URL.Query().Get("servings"); servingsStr != "" {
+		var err error
+		servings, err = strconv.Atoi(servingsStr)
+		if err != nil || servings <= 0 {
+			return 0, "", pkg.ErrServings
+		}
+	}
+	return servings, strings.ToLower(r.URL.Query().Get("units")), nil
+}
+
+// scaleRecipes applies the servings and units query parameters to a page of
+// recipes. Recipes without a serving size only get their units converted.
+func scaleRecipes(svc recipe.Service, r *http.Request, records interface{}) error {
+	servings, units, err := scaleParams(r)
+	if err != nil {
+		return err
+	}
+	recipes, ok := records.(*[]entities.Recipe)
+	if !ok || (servings == 0 && units == "") {
+		return nil
 	}
+	for i := range *recipes {
+		rec := &(*recipes)[i]
+		recipeServings := servings
+		if rec.Servings == 0 {
+			recipeServings = 0
+		}
+		scaled, err := svc.ScaleRecipe(rec, recipeServings, units)
+		if err != nil {
+			return err
+		}
+		*rec = *scaled
+	}
+	return nil
+}
+
+// The max_total_time and sort query parameters recipe lists can be fetched
+// with
+func listFilter(r *http.Request) (*recipe.Filter, error) {
+	maxTotalTime, err := parseDuration(r.URL.Query().Get("max_total_time"))
+	if err != nil {
+		return nil, err
+	}
+	return &recipe.Filter{
+		MaxTotalTime: maxTotalTime,
+		Sort:         strings.ToLower(r.URL.Query().Get("sort")),
+	}, nil
+}
+
+// Times are ISO-8601 durations like "PT1H30M" or a number of minutes
+func parseDuration(value string) (entities.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if minutes, err := strconv.Atoi(value); err == nil {
+		return entities.Duration(minutes * 60), nil
+	}
+	return entities.ParseDuration(value)
+}
 
-	return fmt.Sprintf("data:image/png;base64,%s", encStr)
+// Publish times are RFC 3339 timestamps, none means publishing right away
+func parsePublishAt(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	publishAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, pkg.ErrVisibility
+	}
+	return &publishAt, nil
+}
+
+// Ingredients are sent as a JSON array, plain text from older clients is
+// parsed line by line
+func decodeIngredients(value string) ([]entities.Ingredient, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "[") {
+		return recipe.ParseIngredients(value), nil
+	}
+	var ingredients []entities.Ingredient
+	if err := json.Unmarshal([]byte(value), &ingredients); err != nil {
+		return nil, pkg.ErrIngredients
+	}
+	return ingredients, nil
+}
+
+// Steps are sent as a JSON array in steps, older clients send the procedure
+// as text
+func decodeSteps(r *http.Request) ([]entities.Step, error) {
+	value := strings.TrimSpace(r.FormValue("steps"))
+	if value == "" {
+		return recipe.ParseSteps(r.FormValue("procedure")), nil
+	}
+	var steps []entities.Step
+	if err := json.Unmarshal([]byte(value), &steps); err != nil {
+		return nil, pkg.ErrSteps
+	}
+	return steps, nil
+}
+
+// Tags are sent as a JSON array, or as text like "cuisine:italian, weeknight"
+func decodeTags(value string) ([]entities.Tag, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "[") {
+		return recipe.ParseTags(value), nil
+	}
+	var tags []entities.Tag
+	if err := json.Unmarshal([]byte(value), &tags); err != nil {
+		return nil, pkg.ErrTags
+	}
+	return tags, nil
+}
+
+// Dietary labels are sent as a JSON array or comma separated
+func decodeLabels(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "[") {
+		return strings.Split(value, ","), nil
+	}
+	var labels []string
+	if err := json.Unmarshal([]byte(value), &labels); err != nil {
+		return nil, pkg.ErrDietary
+	}
+	return labels, nil
 }
 
 func MakeRecipeHandler(r *http.ServeMux, svc recipe.Service) {
 	r.Handle("/api/v1/recipe/create", middleware.Validate(createRecipe(svc)))
 	r.Handle("/api/v1/recipe/update", middleware.Validate(updateRecipe(svc)))
 	r.Handle("/api/v1/recipe/delete", middleware.Validate(deleteRecipe(svc)))
+	r.Handle("/api/v1/recipe/view", middleware.Validate(showRecipe(svc)))
 	r.Handle("/api/v1/recipe/viewofuser", middleware.Validate(showAllRecipesOfUser(svc)))
 	r.Handle("/api/v1/recipe/viewmine", middleware.Validate(showMyRecipes(svc)))
 	r.Handle("/api/v1/recipe/viewmyfeed", middleware.Validate(showUserFeed(svc)))
@@ -645,4 +1056,6 @@ func MakeRecipeHandler(r *http.ServeMux, svc recipe.Service) {
 	r.Handle("/api/v1/recipe/unlike", middleware.Validate(unlikeRecipe(svc)))
 	r.Handle("/api/v1/recipe/viewuserlikes", middleware.Validate(showUsersWhoLiked(svc)))
 	r.Handle("/api/v1/recipe/search", middleware.Validate(searchRecipes(svc)))
+	r.Handle("/api/v1/recipe/fork", middleware.Validate(forkRecipe(svc)))
+	r.Handle("/api/v1/recipe/forks", middleware.Validate(showForks(svc)))
 }
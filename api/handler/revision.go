@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/rithikjain/SocialRecipe/api/middleware"
+	"github.com/rithikjain/SocialRecipe/api/view"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/recipe"
+	"net/http"
+	"strconv"
+)
+
+// Protected Request
+func showRevisions(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		recipeIDStr := r.URL.Query().Get("recipe_id")
+		if recipeIDStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		recipeID, _ := strconv.Atoi(recipeIDStr)
+		rec, err := svc.FindRecipeByID(uint(recipeID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if rec.UserID != userID {
+			view.Wrap(pkg.ErrUnauthorized, w)
+			return
+		}
+
+		var pageNo = 1
+		pageNoStr := r.URL.Query().Get("page")
+		if pageNoStr != "" {
+			pageNo, _ = strconv.Atoi(pageNoStr)
+		}
+
+		page, err := svc.GetRevisions(rec.ID, pageNo)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		hasNextPage := true
+		if page.Page >= page.TotalPage {
+			hasNextPage = false
+		}
+
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":       "Revisions fetched",
+			"revisions":     page.Records,
+			"page":          page.Page,
+			"has_next_page": hasNextPage,
+			"total_pages":   page.TotalPage,
+		})
+	})
+}
+
+// Protected Request
+func showRevision(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		recipeIDStr := r.URL.Query().Get("recipe_id")
+		numberStr := r.URL.Query().Get("number")
+		if recipeIDStr == "" || numberStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		recipeID, _ := strconv.Atoi(recipeIDStr)
+		number, _ := strconv.Atoi(numberStr)
+		rec, err := svc.FindRecipeByID(uint(recipeID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if rec.UserID != userID {
+			view.Wrap(pkg.ErrUnauthorized, w)
+			return
+		}
+
+		revision, err := svc.GetRevision(rec.ID, number)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":  "Revision fetched",
+			"revision": revision,
+		})
+	})
+}
+
+// Protected Request
+func diffRevisions(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		recipeIDStr := r.URL.Query().Get("recipe_id")
+		fromStr := r.URL.Query().Get("from")
+		toStr := r.URL.Query().Get("to")
+		if recipeIDStr == "" || fromStr == "" || toStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		recipeID, _ := strconv.Atoi(recipeIDStr)
+		from, _ := strconv.Atoi(fromStr)
+		to, _ := strconv.Atoi(toStr)
+		rec, err := svc.FindRecipeByID(uint(recipeID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if rec.UserID != userID {
+			view.Wrap(pkg.ErrUnauthorized, w)
+			return
+		}
+
+		changes, err := svc.DiffRevisions(rec.ID, from, to)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Revisions compared",
+			"from":    from,
+			"to":      to,
+			"changes": changes,
+		})
+	})
+}
+
+// Protected Request
+func restoreRevision(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		type Restore struct {
+			RecipeID uint `json:"recipe_id"`
+			Number   int  `json:"number"`
+		}
+		var body Restore
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		rec, err := svc.FindRecipeByID(body.RecipeID)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if rec.UserID != userID {
+			view.Wrap(pkg.ErrUnauthorized, w)
+			return
+		}
+
+		re, err := svc.RestoreRevision(rec.ID, body.Number)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Revision restored",
+			"recipe":  re,
+		})
+	})
+}
+
+func MakeRevisionHandler(r *http.ServeMux, svc recipe.Service) {
+	r.Handle("/api/v1/recipe/revisions", middleware.Validate(showRevisions(svc)))
+	r.Handle("/api/v1/recipe/revisions/view", middleware.Validate(showRevision(svc)))
+	r.Handle("/api/v1/recipe/revisions/diff", middleware.Validate(diffRevisions(svc)))
+	r.Handle("/api/v1/recipe/revisions/restore", middleware.Validate(restoreRevision(svc)))
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/rithikjain/SocialRecipe/api/middleware"
+	"github.com/rithikjain/SocialRecipe/api/view"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"github.com/rithikjain/SocialRecipe/pkg/recipe"
+	"net/http"
+	"strconv"
+)
+
+// Protected Request
+func addStep(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		_ = r.ParseMultipartForm(10 << 20)
+		_ = r.ParseForm()
+
+		recipeID, _ := strconv.Atoi(r.FormValue("recipe_id"))
+		rec, err := svc.FindRecipeByID(uint(recipeID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if rec.UserID != userID {
+			view.Wrap(pkg.ErrUnauthorized, w)
+			return
+		}
+
+		// Steps go to the end unless a position is given
+		position := -1
+		if positionStr := r.FormValue("position"); positionStr != "" {
+			position, _ = strconv.Atoi(positionStr)
+		}
+		duration, _ := strconv.Atoi(r.FormValue("duration_seconds"))
+		step := &entities.Step{
+			RecipeID:        rec.ID,
+			Position:        position,
+			Text:            r.FormValue("text"),
+			DurationSeconds: duration,
+		}
+
+		if r.MultipartForm != nil && len(r.MultipartForm.File["image"]) > 0 {
+			stored, err := uploadImage(r, "image")
+			if err != nil {
+				view.Wrap(err, w)
+				return
+			}
+			step.ImgUrl = stored.URL
+			step.ImgPublicId = stored.ID
+			step.ImgVariants = stored.Variants
+		}
+
+		steps, err := svc.AddStep(step)
+		if err != nil {
+			if step.ImgPublicId != "" {
+				_ = destroyImage(step.ImgPublicId)
+			}
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Step added",
+			"steps":   steps,
+		})
+	})
+}
+
+// Protected Request
+func deleteStep(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		recipeIDStr := r.URL.Query().Get("recipe_id")
+		stepIDStr := r.URL.Query().Get("step_id")
+		if recipeIDStr == "" || stepIDStr == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		recipeID, _ := strconv.Atoi(recipeIDStr)
+		stepID, _ := strconv.Atoi(stepIDStr)
+		rec, err := svc.FindRecipeByID(uint(recipeID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if rec.UserID != userID {
+			view.Wrap(pkg.ErrUnauthorized, w)
+			return
+		}
+
+		steps, err := svc.DeleteStep(rec.ID, uint(stepID))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Step deleted",
+			"steps":   steps,
+		})
+	})
+}
+
+// Protected Request
+func reorderSteps(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		type Reorder struct {
+			RecipeID uint   `json:"recipe_id"`
+			StepIDs  []uint `json:"step_ids"`
+		}
+		var body Reorder
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		rec, err := svc.FindRecipeByID(body.RecipeID)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if rec.UserID != userID {
+			view.Wrap(pkg.ErrUnauthorized, w)
+			return
+		}
+
+		steps, err := svc.ReorderSteps(rec.ID, body.StepIDs)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Steps reordered",
+			"steps":   steps,
+		})
+	})
+}
+
+func MakeStepHandler(r *http.ServeMux, svc recipe.Service) {
+	r.Handle("/api/v1/recipe/step/add", middleware.Validate(addStep(svc)))
+	r.Handle("/api/v1/recipe/step/delete", middleware.Validate(deleteStep(svc)))
+	r.Handle("/api/v1/recipe/step/reorder", middleware.Validate(reorderSteps(svc)))
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/rithikjain/SocialRecipe/api/middleware"
+	"github.com/rithikjain/SocialRecipe/api/view"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/recipe"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Protected Request
+func showVocabularies() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":      "Vocabularies fetched",
+			"vocabularies": recipe.Vocabularies(),
+		})
+	})
+}
+
+// Protected Request
+func showPopularTags(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		kind := strings.ToLower(r.URL.Query().Get("kind"))
+		tags, err := svc.GetPopularTags(kind, limit)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Tags fetched",
+			"tags":    tags,
+		})
+	})
+}
+
+// Protected Request
+func showRecipesByTag(svc recipe.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		// Get user id from claims
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		viewerID := uint(claims["id"].(float64))
+
+		var pageNo = 1
+		pageNoStr := r.URL.Query().Get("page")
+		if pageNoStr != "" {
+			pageNo, _ = strconv.Atoi(pageNoStr)
+		}
+
+		tag := r.URL.Query().Get("tag")
+		if tag == "" {
+			view.Wrap(pkg.ErrNoContent, w)
+			return
+		}
+		kind := strings.ToLower(r.URL.Query().Get("kind"))
+
+		page, err := svc.ShowRecipesByTag(viewerID, kind, tag, pageNo)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if err := scaleRecipes(svc, r, page.Records); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		hasNextPage := true
+		if page.Page >= page.TotalPage {
+			hasNextPage = false
+		}
+
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":       "Recipes fetched",
+			"recipes":       page.Records,
+			"page":          page.Page,
+			"has_next_page": hasNextPage,
+			"total_pages":   page.TotalPage,
+		})
+	})
+}
+
+func MakeTagHandler(r *http.ServeMux, svc recipe.Service) {
+	r.Handle("/api/v1/recipe/tags/vocabularies", middleware.Validate(showVocabularies()))
+	r.Handle("/api/v1/recipe/tags/popular", middleware.Validate(showPopularTags(svc)))
+	r.Handle("/api/v1/recipe/bytag", middleware.Validate(showRecipesByTag(svc)))
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"github.com/rithikjain/SocialRecipe/api/view"
+	"github.com/rithikjain/SocialRecipe/pkg/imaging"
+	"github.com/rithikjain/SocialRecipe/pkg/storage"
+	"io/ioutil"
+	"net/http"
+)
+
+var imageStore storage.ImageStore
+
+// SetImageStore sets where the handlers put uploaded images.
+func SetImageStore(store storage.ImageStore) {
+	imageStore = store
+}
+
+// Processing the image in field and storing it with its scaled down copies
+func uploadImage(r *http.Request, field string) (*storage.Stored, error) {
+	file, _, err := r.FormFile(field)
+	if err != nil {
+		return nil, view.ErrFile
+	}
+	defer file.Close()
+	fileBytes, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, view.ErrFile
+	}
+
+	processed, err := imaging.Process(fileBytes)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := storage.Put(imageStore, processed)
+	if err != nil {
+		return nil, view.ErrUpload
+	}
+	return stored, nil
+}
+
+// Deleting the image and its copies from the image store
+func destroyImage(id string) error {
+	if err := storage.Remove(imageStore, id); err != nil {
+		if err == storage.ErrDelete {
+			return view.ErrFile
+		}
+		return err
+	}
+	return nil
+}
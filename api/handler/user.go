@@ -1,23 +1,22 @@
 package handler
 
 import (
-	"encoding/base64"
 	"encoding/json"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/rithikjain/SocialRecipe/api/middleware"
 	"github.com/rithikjain/SocialRecipe/api/view"
 	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/auth"
 	"github.com/rithikjain/SocialRecipe/pkg/entities"
 	"github.com/rithikjain/SocialRecipe/pkg/user"
-	"io/ioutil"
+	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func register(svc user.Service) http.Handler {
+func register(svc user.Service, authSvc auth.Service) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			view.Wrap(view.ErrMethodNotAllowed, w)
@@ -60,49 +59,20 @@ func register(svc user.Service) http.Handler {
 			return
 		}
 
-		file, handler, err := r.FormFile("image")
-		if err != nil {
+		if r.MultipartForm == nil || len(r.MultipartForm.File["image"]) == 0 {
 			user.Name = r.FormValue("name")
 			user.PhoneNumber = r.FormValue("phone_number")
 			user.Email = r.FormValue("email")
 			user.Username = r.FormValue("username")
 			user.Password = r.FormValue("password")
-			user.ProfileImgUrl = "https://res.cloudinary.com/dvn1hxflu/image/upload/v1587624171/blank-profile-picture-973460_640_bgnkjn.png"
+			user.ProfileImgUrl = entities.DefaultProfileImgUrl
 			user.ProfileImgPublicID = ""
 			user.Verified = false
 			user.Bio = r.FormValue("bio")
 		} else {
-			defer file.Close()
-
-			fileBytes, err := ioutil.ReadAll(file)
-			if err != nil {
-				view.Wrap(view.ErrFile, w)
-			}
-			imgBase64 := base64.StdEncoding.EncodeToString(fileBytes)
-
-			imgUrl := format(imgBase64, handler.Header.Get("Content-Type"))
-
-			// Uploading the image on cloudinary
-			form := url.Values{}
-			form.Add("file", imgUrl)
-			form.Add("upload_preset", os.Getenv("uploadPreset"))
-
-			response, err := http.PostForm(os.Getenv("cloudinaryUrl"), form)
+			stored, err := uploadImage(r, "image")
 			if err != nil {
-				view.Wrap(view.ErrFile, w)
-				return
-			}
-			defer response.Body.Close()
-
-			var resJson map[string]interface{}
-			err = json.NewDecoder(response.Body).Decode(&resJson)
-			if err != nil {
-				view.Wrap(view.ErrUpload, w)
-				return
-			}
-
-			if response.StatusCode != http.StatusOK {
-				view.Wrap(view.ErrUpload, w)
+				view.Wrap(err, w)
 				return
 			}
 
@@ -111,8 +81,9 @@ func register(svc user.Service) http.Handler {
 			user.PhoneNumber = r.FormValue("phone_number")
 			user.Email = r.FormValue("email")
 			user.Password = r.FormValue("password")
-			user.ProfileImgUrl = resJson["secure_url"].(string)
-			user.ProfileImgPublicID = resJson["public_id"].(string)
+			user.ProfileImgUrl = stored.URL
+			user.ProfileImgPublicID = stored.ID
+			user.ProfileImgVariants = stored.Variants
 			user.Verified = false
 			user.Bio = r.FormValue("bio")
 		}
@@ -122,11 +93,7 @@ func register(svc user.Service) http.Handler {
 			view.Wrap(err, w)
 			return
 		}
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"id":   u.ID,
-			"role": "user",
-		})
-		tokenString, err := token.SignedString([]byte(os.Getenv("jwt_secret")))
+		tokens, err := authSvc.IssueTokens(u)
 		if err != nil {
 			view.Wrap(err, w)
 			return
@@ -135,14 +102,16 @@ func register(svc user.Service) http.Handler {
 		w.Header().Add("Content-Type", "application/json; charset=utf-8")
 		w.WriteHeader(http.StatusCreated)
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"message": "Account Created",
-			"token":   tokenString,
-			"user":    u,
+			"message":       "Account Created",
+			"token":         tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"expires_at":    tokens.ExpiresAt,
+			"user":          u,
 		})
 	})
 }
 
-func login(svc user.Service) http.Handler {
+func login(svc user.Service, authSvc auth.Service) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			view.Wrap(view.ErrMethodNotAllowed, w)
@@ -154,17 +123,72 @@ func login(svc user.Service) http.Handler {
 			return
 		}
 
-		u, err := svc.Login(user.Email, user.Password)
+		u, err := svc.Login(user.Email, user.Password, clientIP(r))
 		if err != nil {
 			view.Wrap(err, w)
 			return
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"id":   u.ID,
-			"role": "user",
+		if u.TwoFactorEnabled {
+			challenge, err := authSvc.IssueChallenge(u)
+			if err != nil {
+				view.Wrap(err, w)
+				return
+			}
+			w.Header().Add("Content-Type", "application/json; charset=utf-8")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":             "Two factor authentication required",
+				"two_factor_required": true,
+				"challenge_token":     challenge,
+			})
+			return
+		}
+
+		tokens, err := authSvc.IssueTokens(u)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		u.Password = ""
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":       "Login Successful",
+			"token":         tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"expires_at":    tokens.ExpiresAt,
+			"user":          u,
 		})
-		tokenString, err := token.SignedString([]byte(os.Getenv("jwt_secret")))
+	})
+}
+
+func loginTwoFactor(svc user.Service, authSvc auth.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		type TwoFactor struct {
+			ChallengeToken string `json:"challenge_token"`
+			Code           string `json:"code"`
+		}
+		var body TwoFactor
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		userID, err := authSvc.ConsumeChallenge(body.ChallengeToken)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		u, err := svc.VerifySecondFactor(userID, body.Code, clientIP(r))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		tokens, err := authSvc.IssueTokens(u)
 		if err != nil {
 			view.Wrap(err, w)
 			return
@@ -172,9 +196,436 @@ func login(svc user.Service) http.Handler {
 		u.Password = ""
 		w.Header().Add("Content-Type", "application/json; charset=utf-8")
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"message": "Login Successful",
-			"token":   tokenString,
-			"user":    u,
+			"message":       "Login Successful",
+			"token":         tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"expires_at":    tokens.ExpiresAt,
+			"user":          u,
+		})
+	})
+}
+
+// Protected Request
+func setupTwoFactor(svc user.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		secret, uri, err := svc.SetupTwoFactor(uint(claims["id"].(float64)))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":     "Scan the code and confirm it to enable two factor authentication",
+			"secret":      secret,
+			"otpauth_uri": uri,
+		})
+	})
+}
+
+// Protected Request
+func enableTwoFactor(svc user.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		type Enable struct {
+			Code string `json:"code"`
+		}
+		var body Enable
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		codes, err := svc.EnableTwoFactor(uint(claims["id"].(float64)), body.Code)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":        "Two factor authentication enabled",
+			"recovery_codes": codes,
+		})
+	})
+}
+
+// Protected Request
+func disableTwoFactor(svc user.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		type Disable struct {
+			Password string `json:"password"`
+			Code     string `json:"code"`
+		}
+		var body Disable
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		err = svc.DisableTwoFactor(uint(claims["id"].(float64)), body.Password, body.Code)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Two factor authentication disabled",
+		})
+	})
+}
+
+func refreshToken(authSvc auth.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		type Refresh struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		var body Refresh
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
+			view.Wrap(pkg.ErrRefreshToken, w)
+			return
+		}
+
+		tokens, err := authSvc.Refresh(body.RefreshToken)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":       "Token refreshed",
+			"token":         tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"expires_at":    tokens.ExpiresAt,
+		})
+	})
+}
+
+func forgotPassword(svc user.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		var user entities.User
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		err := svc.RequestPasswordReset(user.Email)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "If an account exists for this email, a reset link has been sent",
+		})
+	})
+}
+
+func resetPassword(svc user.Service, authSvc auth.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		type Reset struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		var body Reset
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		u, err := svc.ResetPassword(body.Token, body.Password)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		// Whoever knew the old password must not stay logged in
+		err = authSvc.LogoutAll(u.ID)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Password has been reset, please login again",
+		})
+	})
+}
+
+func verifyEmail(svc user.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		err := svc.VerifyEmail(r.URL.Query().Get("token"))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Email verified",
+		})
+	})
+}
+
+// Protected Request
+func resendVerification(svc user.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		u, err := svc.GetUserByID(uint(claims["id"].(float64)))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if u.Verified {
+			w.Header().Add("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"message": "Email is already verified",
+			})
+			return
+		}
+
+		err = svc.SendVerification(u)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Verification email sent",
+		})
+	})
+}
+
+// Protected Request
+func changePassword(svc user.Service, authSvc auth.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		type ChangePassword struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+		var body ChangePassword
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		u, err := svc.ChangePassword(uint(claims["id"].(float64)), body.CurrentPassword, body.NewPassword)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		err = authSvc.LogoutAll(u.ID)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Password changed, please login again",
+		})
+	})
+}
+
+// Protected Request
+func changeEmail(svc user.Service, authSvc auth.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		var body entities.User
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		exist, err := svc.DoesEmailExist(body.Email)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if exist {
+			w.Header().Add("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"message": "Email exists",
+			})
+			return
+		}
+
+		u, err := svc.ChangeEmail(uint(claims["id"].(float64)), body.Password, body.Email)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		err = authSvc.LogoutAll(u.ID)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Email changed, please verify it and login again",
+		})
+	})
+}
+
+// Protected Request
+func deleteAccount(svc user.Service, authSvc auth.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		var body entities.User
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+
+		err = svc.DeleteAccount(userID, body.Password)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		err = authSvc.LogoutAll(userID)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Account deleted",
+		})
+	})
+}
+
+// Protected Request
+func logout(authSvc auth.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		type Logout struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		var body Logout
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		jti, _ := claims["jti"].(string)
+		expiresAt := time.Unix(int64(claims["exp"].(float64)), 0)
+		err = authSvc.Logout(uint(claims["id"].(float64)), jti, expiresAt, body.RefreshToken)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Logged out",
+		})
+	})
+}
+
+// Protected Request
+func logoutAll(authSvc auth.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		err = authSvc.LogoutAll(uint(claims["id"].(float64)))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Logged out from all devices",
 		})
 	})
 }
@@ -236,50 +687,22 @@ func updateProfile(svc user.Service) http.Handler {
 			bio = r.FormValue("bio")
 		}
 
-		file, handler, err := r.FormFile("image")
-		if err != nil {
+		if r.MultipartForm == nil || len(r.MultipartForm.File["image"]) == 0 {
 			u.Name = name
 			u.Username = un
 			u.Bio = bio
 		} else {
-			defer file.Close()
-
-			fileBytes, err := ioutil.ReadAll(file)
-			if err != nil {
-				view.Wrap(view.ErrFile, w)
-			}
-			imgBase64 := base64.StdEncoding.EncodeToString(fileBytes)
-
-			imgUrl := format(imgBase64, handler.Header.Get("Content-Type"))
-
-			// Uploading the image on cloudinary
-			form := url.Values{}
-			form.Add("file", imgUrl)
-			form.Add("upload_preset", os.Getenv("uploadPreset"))
-
-			response, err := http.PostForm(os.Getenv("cloudinaryUrl"), form)
+			stored, err := uploadImage(r, "image")
 			if err != nil {
-				view.Wrap(view.ErrFile, w)
-				return
-			}
-			defer response.Body.Close()
-
-			var resJson map[string]interface{}
-			err = json.NewDecoder(response.Body).Decode(&resJson)
-			if err != nil {
-				view.Wrap(view.ErrUpload, w)
-				return
-			}
-
-			if response.StatusCode != http.StatusOK {
-				view.Wrap(view.ErrUpload, w)
+				view.Wrap(err, w)
 				return
 			}
 
 			u.Name = name
 			u.Username = un
-			u.ProfileImgUrl = resJson["secure_url"].(string)
-			u.ProfileImgPublicID = resJson["public_id"].(string)
+			u.ProfileImgUrl = stored.URL
+			u.ProfileImgPublicID = stored.ID
+			u.ProfileImgVariants = stored.Variants
 			u.Bio = bio
 		}
 
@@ -423,7 +846,17 @@ func followUser(svc user.Service) http.Handler {
 		}
 		otherUserID, _ := strconv.Atoi(otherUserIDStr)
 
-		err = svc.FollowUser(uint(claims["id"].(float64)), uint(otherUserID))
+		u, err := svc.GetUserByID(uint(claims["id"].(float64)))
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		if err := user.CheckVerified(u); err != nil {
+			view.Wrap(err, w)
+			return
+		}
+
+		err = svc.FollowUser(u.ID, uint(otherUserID))
 		if err != nil {
 			view.Wrap(err, w)
 			return
@@ -633,10 +1066,75 @@ func updateBio(svc user.Service) http.Handler {
 	})
 }
 
+// Protected Request
+func updateDietaryPreferences(svc user.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			view.Wrap(view.ErrMethodNotAllowed, w)
+			return
+		}
+		type Preferences struct {
+			DietaryPreferences []string `json:"dietary_preferences"`
+		}
+		var prefs Preferences
+		if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+			view.Wrap(pkg.ErrDietary, w)
+			return
+		}
+
+		claims, err := middleware.ValidateAndGetClaims(r.Context(), "user")
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		userID := uint(claims["id"].(float64))
+		preferences, err := svc.UpdateDietaryPreferences(userID, prefs.DietaryPreferences)
+		if err != nil {
+			view.Wrap(err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":             "Dietary preferences updated",
+			"dietary_preferences": preferences,
+		})
+	})
+}
+
+// Heroku's router appends the address it saw to X-Forwarded-For, so the last
+// entry is the only one the client cannot forge
+func clientIP(r *http.Request) string {
+	if os.Getenv("trustProxy") == "true" {
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		if ip := strings.TrimSpace(forwarded[len(forwarded)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // Handlers
-func MakeUserHandler(r *http.ServeMux, svc user.Service) {
-	r.Handle("/api/v1/user/register", register(svc))
-	r.Handle("/api/v1/user/login", login(svc))
+func MakeUserHandler(r *http.ServeMux, svc user.Service, authSvc auth.Service) {
+	r.Handle("/api/v1/user/register", register(svc, authSvc))
+	r.Handle("/api/v1/user/login", login(svc, authSvc))
+	r.Handle("/api/v1/user/login/2fa", loginTwoFactor(svc, authSvc))
+	r.Handle("/api/v1/user/token/refresh", refreshToken(authSvc))
+	r.Handle("/api/v1/user/2fa/setup", middleware.Validate(setupTwoFactor(svc)))
+	r.Handle("/api/v1/user/2fa/enable", middleware.Validate(enableTwoFactor(svc)))
+	r.Handle("/api/v1/user/2fa/disable", middleware.Validate(disableTwoFactor(svc)))
+	r.Handle("/api/v1/user/password/forgot", forgotPassword(svc))
+	r.Handle("/api/v1/user/password/reset", resetPassword(svc, authSvc))
+	r.Handle("/api/v1/user/verify", verifyEmail(svc))
+	r.Handle("/api/v1/user/verify/resend", middleware.Validate(resendVerification(svc)))
+	r.Handle("/api/v1/user/changepassword", middleware.Validate(changePassword(svc, authSvc)))
+	r.Handle("/api/v1/user/changeemail", middleware.Validate(changeEmail(svc, authSvc)))
+	r.Handle("/api/v1/user/delete", middleware.Validate(deleteAccount(svc, authSvc)))
+	r.Handle("/api/v1/user/logout", middleware.Validate(logout(authSvc)))
+	r.Handle("/api/v1/user/logoutall", middleware.Validate(logoutAll(authSvc)))
 	r.Handle("/api/v1/user/updateprofile", middleware.Validate(updateProfile(svc)))
 	r.Handle("/api/v1/user/details", middleware.Validate(userDetails(svc)))
 	r.Handle("/api/v1/user/addrecipetofav", middleware.Validate(addRecipeToFav(svc)))
@@ -647,4 +1145,5 @@ func MakeUserHandler(r *http.ServeMux, svc user.Service) {
 	r.Handle("/api/v1/user/viewfollowing", middleware.Validate(viewFollowing(svc)))
 	r.Handle("/api/v1/user/search", middleware.Validate(searchUsers(svc)))
 	r.Handle("/api/v1/user/updatebio", middleware.Validate(updateBio(svc)))
+	r.Handle("/api/v1/user/dietary", middleware.Validate(updateDietaryPreferences(svc)))
 }
@@ -6,20 +6,62 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/rithikjain/SocialRecipe/api/view"
 	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/auth"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
 	"log"
 	"net/http"
-	"os"
 )
 
+var authSvc auth.Service
+
+// SetAuthService gives the middleware access to the signing keys and the
+// token revocation list.
+func SetAuthService(svc auth.Service) {
+	authSvc = svc
+}
+
 func Validate(h http.Handler) http.Handler {
 	jwtMiddleware := jwtmiddleware.New(jwtmiddleware.Options{
+		// The algorithm is checked against the key the kid header points to
 		ValidationKeyGetter: func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("jwt_secret")), nil
+			if authSvc == nil {
+				return nil, view.ErrInvalidToken
+			}
+			return authSvc.VerificationKey(token)
 		},
-		SigningMethod: jwt.SigningMethodHS256,
 	})
 
-	return jwtMiddleware.Handler(h)
+	return jwtMiddleware.Handler(checkToken(h))
+}
+
+func checkToken(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := r.Context().Value("user").(*jwt.Token)
+		if !ok {
+			view.Wrap(view.ErrInvalidToken, w)
+			return
+		}
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			view.Wrap(view.ErrInvalidToken, w)
+			return
+		}
+
+		// Only access tokens may be used here, not two factor challenges
+		if typ, ok := claims["typ"]; ok && typ != auth.TypeAccess {
+			view.Wrap(view.ErrInvalidToken, w)
+			return
+		}
+
+		jti, _ := claims["jti"].(string)
+		id, _ := claims["id"].(float64)
+		iat, _ := claims["iat"].(float64)
+		if authSvc != nil && authSvc.IsRevoked(jti, uint(id), iat) {
+			view.Wrap(view.ErrRevokedToken, w)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
 }
 
 func ValidateAndGetClaims(ctx context.Context, role string) (map[string]interface{}, error) {
@@ -36,11 +78,17 @@ func ValidateAndGetClaims(ctx context.Context, role string) (map[string]interfac
 		return nil, view.ErrInvalidToken
 	}
 
+	// Valid only checks exp when it is present, so tokens issued before
+	// access tokens started expiring must be rejected explicitly
+	if _, ok := claims["exp"].(float64); !ok {
+		return nil, view.ErrInvalidToken
+	}
 	if claims.Valid() != nil {
 		return nil, view.ErrInvalidToken
 	}
 
-	if claims["role"].(string) != role {
+	// Admins can use every endpoint a user can
+	if tokenRole, _ := claims["role"].(string); tokenRole != role && tokenRole != entities.RoleAdmin {
 		log.Println(claims["role"])
 		return nil, pkg.ErrUnauthorized
 	}
@@ -16,6 +16,7 @@ type ErrView struct {
 var (
 	ErrMethodNotAllowed = errors.New("Error: Method is not allowed")
 	ErrInvalidToken     = errors.New("Error: Invalid Authorization token")
+	ErrRevokedToken     = errors.New("Error: Authorization token has been revoked")
 	ErrUserExists       = errors.New("Error: User already exists")
 	ErrFile             = errors.New("Error: Something wrong with file")
 	ErrUpload           = errors.New("Error: Upload failed")
@@ -31,8 +32,40 @@ var ErrHTTPStatusMap = map[string]int{
 	pkg.ErrForbidden.Error():    http.StatusForbidden,
 	pkg.ErrEmail.Error():        http.StatusBadRequest,
 	pkg.ErrPassword.Error():     http.StatusBadRequest,
+	pkg.ErrRefreshToken.Error(): http.StatusUnauthorized,
+	pkg.ErrTokenReuse.Error():   http.StatusUnauthorized,
+	pkg.ErrResetToken.Error():   http.StatusBadRequest,
+	pkg.ErrVerifyToken.Error():  http.StatusBadRequest,
+	pkg.ErrNotVerified.Error():  http.StatusForbidden,
+	pkg.ErrTooMany.Error():      http.StatusTooManyRequests,
+	pkg.ErrWrongPass.Error():    http.StatusUnauthorized,
+	pkg.ErrSuspended.Error():    http.StatusForbidden,
+	pkg.ErrNotReady.Error():     http.StatusConflict,
+	pkg.ErrTwoFactor.Error():    http.StatusUnauthorized,
+	pkg.ErrTwoFactorOn.Error():  http.StatusConflict,
+	pkg.ErrTwoFactorOff.Error(): http.StatusBadRequest,
+	pkg.ErrLocked.Error():       http.StatusTooManyRequests,
+	pkg.ErrProvider.Error():     http.StatusNotFound,
+	pkg.ErrLoginState.Error():   http.StatusBadRequest,
+	pkg.ErrProviderAuth.Error(): http.StatusUnauthorized,
+	pkg.ErrNoEmail.Error():      http.StatusBadRequest,
+	pkg.ErrLinkAccount.Error():  http.StatusConflict,
+	pkg.ErrIngredients.Error():  http.StatusBadRequest,
+	pkg.ErrSteps.Error():        http.StatusBadRequest,
+	pkg.ErrServings.Error():     http.StatusBadRequest,
+	pkg.ErrUnits.Error():        http.StatusBadRequest,
+	pkg.ErrTags.Error():         http.StatusBadRequest,
+	pkg.ErrDietary.Error():      http.StatusBadRequest,
+	pkg.ErrDuration.Error():     http.StatusBadRequest,
+	pkg.ErrSort.Error():         http.StatusBadRequest,
+	pkg.ErrImages.Error():       http.StatusBadRequest,
+	pkg.ErrImageType.Error():    http.StatusUnsupportedMediaType,
+	pkg.ErrImageSize.Error():    http.StatusRequestEntityTooLarge,
+	pkg.ErrForkOwn.Error():      http.StatusBadRequest,
+	pkg.ErrVisibility.Error():   http.StatusBadRequest,
 	ErrMethodNotAllowed.Error(): http.StatusMethodNotAllowed,
 	ErrInvalidToken.Error():     http.StatusBadRequest,
+	ErrRevokedToken.Error():     http.StatusUnauthorized,
 	ErrUserExists.Error():       http.StatusConflict,
 	ErrFile.Error():             http.StatusBadRequest,
 }
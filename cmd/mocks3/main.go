@@ -0,0 +1,102 @@
+// Command mocks3 is a minimal S3 compatible object store for trying out the
+// s3 image store locally. Objects are kept in memory, addressed by path as
+// /bucket/key, and anyone can read them. Writes have to be signed with the
+// access key, though the signature itself is not checked.
+//
+// Point the API at it with
+//
+//	imageStore=s3 s3Endpoint=http://localhost:9100 s3Bucket=images s3AccessKey=mock s3SecretKey=secret
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type object struct {
+	contentType string
+	data        []byte
+}
+
+type store struct {
+	accessKey string
+
+	mu      sync.Mutex
+	objects map[string]object
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:9100", "address to listen on")
+	accessKey := flag.String("access-key", "mock", "access key the API uses")
+	flag.Parse()
+
+	s := &store{
+		accessKey: *accessKey,
+		objects:   map[string]object{},
+	}
+	log.Printf("Mock S3 at http://%s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
+
+func (s *store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.Contains(path, "/") {
+		http.Error(w, "no such key", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.mu.Lock()
+		obj, ok := s.objects[path]
+		s.mu.Unlock()
+		if !ok {
+			http.Error(w, "no such key", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		_, _ = w.Write(obj.data)
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !s.authorized(r, data) {
+			http.Error(w, "access denied", http.StatusForbidden)
+			return
+		}
+		s.mu.Lock()
+		s.objects[path] = object{contentType: r.Header.Get("Content-Type"), data: data}
+		s.mu.Unlock()
+		log.Printf("stored %s (%d bytes)", path, len(data))
+	case http.MethodDelete:
+		if !s.authorized(r, nil) {
+			http.Error(w, "access denied", http.StatusForbidden)
+			return
+		}
+		s.mu.Lock()
+		delete(s.objects, path)
+		s.mu.Unlock()
+		log.Printf("deleted %s", path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authorized checks the request was signed with the access key and that the
+// payload hash it carries matches the body.
+func (s *store) authorized(r *http.Request, body []byte) bool {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/") {
+		return false
+	}
+	sum := sha256.Sum256(body)
+	return r.Header.Get("X-Amz-Content-Sha256") == hex.EncodeToString(sum[:])
+}
@@ -6,12 +6,21 @@ import (
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	"github.com/joho/godotenv"
 	"github.com/rithikjain/SocialRecipe/api/handler"
+	"github.com/rithikjain/SocialRecipe/api/middleware"
+	"github.com/rithikjain/SocialRecipe/pkg/auth"
 	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"github.com/rithikjain/SocialRecipe/pkg/export"
+	"github.com/rithikjain/SocialRecipe/pkg/mailer"
+	"github.com/rithikjain/SocialRecipe/pkg/nutrition"
+	"github.com/rithikjain/SocialRecipe/pkg/oidc"
 	"github.com/rithikjain/SocialRecipe/pkg/recipe"
+	"github.com/rithikjain/SocialRecipe/pkg/storage"
 	"github.com/rithikjain/SocialRecipe/pkg/user"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
 func dbConnect(host, port, user, dbname, password, sslmode string) (*gorm.DB, error) {
@@ -63,23 +72,169 @@ func main() {
 	db.AutoMigrate(
 		&entities.User{},
 		&entities.Recipe{},
+		&entities.Ingredient{},
+		&entities.Step{},
+		&entities.RecipeImage{},
+		&entities.RecipeRevision{},
+		&entities.Tag{},
 		&entities.FavoriteRecipe{},
 		&entities.LikeDetail{},
 		&entities.Follower{},
 		&entities.Following{},
+		&entities.RefreshToken{},
+		&entities.RevokedToken{},
+		&entities.PasswordResetToken{},
+		&entities.ImageDeletion{},
+		&entities.DataExport{},
+		&entities.RecoveryCode{},
+		&entities.LoginThrottle{},
+		&entities.SigningKey{},
+		&entities.UserIdentity{},
+		&entities.LoginState{},
 	)
 
 	// Initializing repos and services
+	authRepo := auth.NewRepo(db)
+	authSvc := auth.NewService(authRepo)
+	if err := authSvc.RotateKeys(); err != nil {
+		log.Fatalf("Error loading signing keys: %s", err.Error())
+	}
+	middleware.SetAuthService(authSvc)
+
+	imageStore := storage.FromEnv()
+	handler.SetImageStore(imageStore)
+
+	if err := user.SetVerificationSecret(os.Getenv("verificationSecret")); err != nil {
+		log.Fatalf("Error loading verification secret: %s", err.Error())
+	}
 	userRepo := user.NewRepo(db)
-	userSvc := user.NewService(userRepo)
+	mail := mailer.FromEnv()
+	userSvc := user.NewService(userRepo, mail)
 
+	if err := nutrition.LoadDietaryRules(os.Getenv("dietaryRules")); err != nil {
+		log.Fatalf("Error loading dietary rules: %s", err.Error())
+	}
 	recipeRepo := recipe.NewRepo(db)
-	recipeSvc := recipe.NewService(recipeRepo)
+	recipeSvc := recipe.NewService(recipeRepo, mail)
+	if converted, err := recipeSvc.MigrateLegacyIngredients(); err != nil {
+		log.Printf("Error converting recipe ingredients: %s", err.Error())
+	} else if converted > 0 {
+		log.Printf("Converted the ingredients of %d recipes", converted)
+	}
+	if converted, err := recipeSvc.MigrateLegacyProcedures(); err != nil {
+		log.Printf("Error converting recipe procedures: %s", err.Error())
+	} else if converted > 0 {
+		log.Printf("Converted the procedures of %d recipes", converted)
+	}
+	if converted, err := recipeSvc.MigrateCoverImages(); err != nil {
+		log.Printf("Error converting recipe images: %s", err.Error())
+	} else if converted > 0 {
+		log.Printf("Started the image galleries of %d recipes", converted)
+	}
+	if converted, err := recipeSvc.MigrateRevisions(); err != nil {
+		log.Printf("Error starting recipe revisions: %s", err.Error())
+	} else if converted > 0 {
+		log.Printf("Started the revisions of %d recipes", converted)
+	}
+	if converted, err := recipeSvc.MigrateVisibility(); err != nil {
+		log.Printf("Error dating published recipes: %s", err.Error())
+	} else if converted > 0 {
+		log.Printf("Dated the publication of %d recipes", converted)
+	}
+	if updated, err := recipeSvc.RecalculateNutrition(); err != nil {
+		log.Printf("Error estimating recipe nutrition: %s", err.Error())
+	} else if updated > 0 {
+		log.Printf("Estimated the nutrition of %d recipes", updated)
+	}
+	if updated, err := recipeSvc.RecalculateDietaryLabels(); err != nil {
+		log.Printf("Error labelling recipes: %s", err.Error())
+	} else if updated > 0 {
+		log.Printf("Updated the dietary labels of %d recipes", updated)
+	}
+
+	exportRepo := export.NewRepo(db)
+	exportSvc := export.NewService(exportRepo, os.Getenv("exportDir"))
+	if err := exportSvc.ResumeUnfinishedExports(); err != nil {
+		log.Printf("Error resuming data exports: %s", err.Error())
+	}
+
+	providers, err := oidc.ProvidersFromEnv()
+	if err != nil {
+		log.Fatalf("Error reading login providers: %s", err.Error())
+	}
+	oidcRepo := oidc.NewRepo(db)
+	oidcSvc := oidc.NewService(oidcRepo, providers)
+
+	// Granting the admin role to the configured accounts
+	for _, email := range strings.Split(os.Getenv("adminEmails"), ",") {
+		if email = strings.TrimSpace(email); email == "" {
+			continue
+		}
+		if err := userSvc.PromoteToAdmin(email); err != nil {
+			log.Printf("Could not make %s an admin: %s", email, err.Error())
+		}
+	}
+
+	// Picking up signing keys created by other instances and rotating them
+	go func() {
+		for range time.Tick(auth.KeyReloadInterval) {
+			if err := authSvc.RotateKeys(); err != nil {
+				log.Printf("Error rotating signing keys: %s", err.Error())
+			}
+		}
+	}()
+
+	// Publishing scheduled recipes once their time has come
+	go func() {
+		for range time.Tick(time.Minute) {
+			if published, err := recipeSvc.PublishScheduledRecipes(); err != nil {
+				log.Printf("Error publishing scheduled recipes: %s", err.Error())
+			} else if published > 0 {
+				log.Printf("Published %d scheduled recipes", published)
+			}
+		}
+	}()
+
+	// Deleting images that are no longer used
+	go func() {
+		for range time.Tick(time.Minute) {
+			err := userSvc.ProcessImageDeletions(func(id string) error {
+				return storage.Remove(imageStore, id)
+			})
+			if err != nil {
+				log.Printf("Error processing image deletions: %s", err.Error())
+			}
+		}
+	}()
+
+	// Removing data exports once their download window is over, and logins
+	// that were never finished
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := exportSvc.DeleteExpiredExports(); err != nil {
+				log.Printf("Error deleting expired exports: %s", err.Error())
+			}
+			if err := oidcSvc.DeleteExpiredLoginStates(); err != nil {
+				log.Printf("Error deleting expired login states: %s", err.Error())
+			}
+		}
+	}()
 
 	// Setting up the router and handlers
 	r := http.NewServeMux()
-	handler.MakeUserHandler(r, userSvc)
+	handler.MakeAuthHandler(r, authSvc)
+	handler.MakeUserHandler(r, userSvc, authSvc)
 	handler.MakeRecipeHandler(r, recipeSvc)
+	handler.MakeStepHandler(r, recipeSvc)
+	handler.MakeImageHandler(r, recipeSvc)
+	handler.MakeRevisionHandler(r, recipeSvc)
+	if images, ok := imageStore.(http.Handler); ok {
+		r.Handle("/images/", images)
+	}
+	handler.MakeTagHandler(r, recipeSvc)
+	handler.MakeAdminHandler(r, userSvc, recipeSvc, authSvc)
+	handler.MakeExportHandler(r, exportSvc)
+	handler.MakeOIDCHandler(r, oidcSvc, userSvc, authSvc)
 
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKeyAlgorithm        = "RS256"
+	defaultKeyRotationInterval = 30 * 24 * time.Hour
+	rsaKeyBits                 = 2048
+
+	// New keys are published this long before they start signing, which has
+	// to be longer than verifiers cache the JWKS for
+	keyPublishLead = time.Hour
+
+	// How often every instance reloads the keys and checks for rotation
+	KeyReloadInterval = time.Minute
+)
+
+var errUnknownKey = errors.New("auth: unknown signing key")
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type signingKey struct {
+	kid         string
+	method      jwt.SigningMethod
+	private     crypto.PrivateKey
+	public      crypto.PublicKey
+	activatesAt time.Time
+}
+
+// keyring holds the parsed signing keys, ordered by activation.
+type keyring struct {
+	mu   sync.RWMutex
+	keys []*signingKey
+}
+
+func (k *keyring) set(keys []*signingKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+}
+
+func (k *keyring) signer(now time.Time) *signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for i := len(k.keys) - 1; i >= 0; i-- {
+		if !k.keys[i].activatesAt.After(now) {
+			return k.keys[i]
+		}
+	}
+	return nil
+}
+
+func (k *keyring) find(kid string) *signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.kid == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+func (k *keyring) all() []*signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys
+}
+
+// RotateKeys reloads the signing keys and creates the next one once the
+// newest key is due for rotation. Keys that got superseded keep verifying for
+// as long as the tokens they signed can live.
+func (s *service) RotateKeys() error {
+	now := time.Now()
+	if err := s.repo.DeleteExpiredSigningKeys(now); err != nil {
+		return err
+	}
+	stored, err := s.repo.GetSigningKeys(now)
+	if err != nil {
+		return err
+	}
+
+	algorithm := keyAlgorithm()
+	var next *entities.SigningKey
+	if len(stored) == 0 {
+		// Nothing can be signed without a key, so the first one is used at once
+		next, err = newSigningKey(algorithm, now)
+	} else if newest := stored[len(stored)-1]; newest.Algorithm != algorithm ||
+		!now.Before(newest.ActivatesAt.Add(keyRotationInterval()-keyPublishLead)) {
+		next, err = newSigningKey(algorithm, now.Add(keyPublishLead))
+	}
+	if err != nil {
+		return err
+	}
+	if next != nil {
+		if err := s.repo.CreateSigningKey(next); err != nil {
+			return err
+		}
+		stored = append(stored, *next)
+	}
+
+	keys := make([]*signingKey, 0, len(stored))
+	for i := range stored {
+		key, err := parseSigningKey(&stored[i])
+		if err != nil {
+			log.Printf("signing key %s is unusable: %s", stored[i].KID, err.Error())
+			continue
+		}
+		keys = append(keys, key)
+	}
+	s.keys.set(keys)
+
+	if current := s.keys.signer(now); current != nil {
+		return s.repo.ExpireSigningKeys(current.activatesAt, current.activatesAt.Add(keyRetention()))
+	}
+	return nil
+}
+
+// VerificationKey looks up the key a token was signed with by its kid. The
+// algorithm in the header has to be the one of that key, so a token cannot
+// pick how it gets verified.
+func (s *service) VerificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key := s.keys.find(kid)
+	if key == nil || token.Method.Alg() != key.method.Alg() {
+		return nil, errUnknownKey
+	}
+	return key.public, nil
+}
+
+// JWKS lists the public keys tokens may currently be signed with, including
+// the next key before it activates.
+func (s *service) JWKS() *JWKS {
+	set := &JWKS{Keys: []JWK{}}
+	for _, key := range s.keys.all() {
+		jwk := JWK{
+			KeyID:     key.kid,
+			Use:       "sig",
+			Algorithm: key.method.Alg(),
+		}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func (s *service) sign(claims jwt.MapClaims) (string, error) {
+	key := s.keys.signer(time.Now())
+	if key == nil {
+		return "", pkg.ErrSigningKey
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+func newSigningKey(algorithm string, activatesAt time.Time) (*entities.SigningKey, error) {
+	var private crypto.PrivateKey
+	var public crypto.PublicKey
+	switch algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		private, public = key, &key.PublicKey
+	case SigningMethodEdDSA.Alg():
+		pub, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private, public = key, pub
+	default:
+		return nil, errors.New("auth: unsupported signing algorithm " + algorithm)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	return &entities.SigningKey{
+		KID:         kid[:16],
+		Algorithm:   algorithm,
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		PublicKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		ActivatesAt: activatesAt,
+	}, nil
+}
+
+func parseSigningKey(stored *entities.SigningKey) (*signingKey, error) {
+	method := jwt.GetSigningMethod(stored.Algorithm)
+	if method == nil {
+		return nil, errors.New("auth: unsupported signing algorithm " + stored.Algorithm)
+	}
+	privateBlock, _ := pem.Decode([]byte(stored.PrivateKey))
+	publicBlock, _ := pem.Decode([]byte(stored.PublicKey))
+	if privateBlock == nil || publicBlock == nil {
+		return nil, errors.New("auth: malformed key")
+	}
+	private, err := x509.ParsePKCS8PrivateKey(privateBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.ParsePKIXPublicKey(publicBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{
+		kid:         stored.KID,
+		method:      method,
+		private:     private,
+		public:      public,
+		activatesAt: stored.ActivatesAt,
+	}, nil
+}
+
+func keyAlgorithm() string {
+	if algorithm := os.Getenv("jwtAlgorithm"); algorithm != "" {
+		return algorithm
+	}
+	return defaultKeyAlgorithm
+}
+
+func keyRotationInterval() time.Duration {
+	return durationFromEnv("keyRotationInterval", defaultKeyRotationInterval)
+}
+
+// A superseded key has to outlive every token it signed, with some slack for
+// clocks drifting between instances.
+func keyRetention() time.Duration {
+	ttl := AccessTokenTTL()
+	if challengeTTL > ttl {
+		ttl = challengeTTL
+	}
+	return ttl + KeyReloadInterval
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"time"
+)
+
+type Repository interface {
+	FindUserByID(id uint) (*entities.User, error)
+
+	CreateRefreshToken(token *entities.RefreshToken) (*entities.RefreshToken, error)
+
+	FindRefreshToken(tokenHash string) (*entities.RefreshToken, error)
+
+	RotateRefreshToken(current, next *entities.RefreshToken) (bool, error)
+
+	RevokeTokenFamily(family string) error
+
+	RevokeUserRefreshTokens(userID uint) error
+
+	CreateRevokedToken(revoked *entities.RevokedToken) error
+
+	GetActiveRevokedTokens(now time.Time) ([]entities.RevokedToken, error)
+
+	DeleteExpiredRevokedTokens(now time.Time) error
+
+	CreateSigningKey(key *entities.SigningKey) error
+
+	GetSigningKeys(now time.Time) ([]entities.SigningKey, error)
+
+	ExpireSigningKeys(activeBefore, expiresAt time.Time) error
+
+	DeleteExpiredSigningKeys(now time.Time) error
+}
+
+type repo struct {
+	DB *gorm.DB
+}
+
+func NewRepo(db *gorm.DB) Repository {
+	return &repo{
+		DB: db,
+	}
+}
+
+func (r *repo) FindUserByID(id uint) (*entities.User, error) {
+	user := &entities.User{}
+	r.DB.Where("id = ?", id).First(user)
+	if user.Email == "" {
+		return nil, pkg.ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *repo) CreateRefreshToken(token *entities.RefreshToken) (*entities.RefreshToken, error) {
+	if err := r.DB.Create(token).Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return token, nil
+}
+
+func (r *repo) FindRefreshToken(tokenHash string) (*entities.RefreshToken, error) {
+	token := &entities.RefreshToken{}
+	result := r.DB.Where("token_hash = ?", tokenHash).First(token)
+	if result.RecordNotFound() {
+		return nil, pkg.ErrNotFound
+	}
+	if result.Error != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return token, nil
+}
+
+// RotateRefreshToken revokes current and stores next in one transaction. It reports
+// false without storing anything if current had already been revoked, which happens
+// when two requests race to use the same refresh token.
+func (r *repo) RotateRefreshToken(current, next *entities.RefreshToken) (bool, error) {
+	tx := r.DB.Begin()
+	result := tx.Model(&entities.RefreshToken{}).
+		Where("id = ? and revoked = ?", current.ID, false).
+		Update("revoked", true)
+	if result.Error != nil {
+		tx.Rollback()
+		return false, pkg.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+	if err := tx.Create(next).Error; err != nil {
+		tx.Rollback()
+		return false, pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, pkg.ErrDatabase
+	}
+	return true, nil
+}
+
+func (r *repo) RevokeTokenFamily(family string) error {
+	err := r.DB.Model(&entities.RefreshToken{}).Where("family = ?", family).Update("revoked", true).Error
+	if err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) RevokeUserRefreshTokens(userID uint) error {
+	err := r.DB.Model(&entities.RefreshToken{}).Where("user_id = ? and revoked = ?", userID, false).Update("revoked", true).Error
+	if err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) CreateRevokedToken(revoked *entities.RevokedToken) error {
+	if err := r.DB.Create(revoked).Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) GetActiveRevokedTokens(now time.Time) ([]entities.RevokedToken, error) {
+	var revoked []entities.RevokedToken
+	if err := r.DB.Where("expires_at > ?", now).Find(&revoked).Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return revoked, nil
+}
+
+func (r *repo) DeleteExpiredRevokedTokens(now time.Time) error {
+	err := r.DB.Where("expires_at <= ?", now).Unscoped().Delete(&entities.RevokedToken{}).Error
+	if err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) CreateSigningKey(key *entities.SigningKey) error {
+	if err := r.DB.Create(key).Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) GetSigningKeys(now time.Time) ([]entities.SigningKey, error) {
+	var keys []entities.SigningKey
+	err := r.DB.Where("expires_at is null or expires_at > ?", now).Order("activates_at asc").Find(&keys).Error
+	if err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return keys, nil
+}
+
+// ExpireSigningKeys schedules the expiry of every key that activated before
+// activeBefore and has not been given an expiry yet.
+func (r *repo) ExpireSigningKeys(activeBefore, expiresAt time.Time) error {
+	err := r.DB.Model(&entities.SigningKey{}).
+		Where("activates_at < ? and expires_at is null", activeBefore).
+		Update("expires_at", expiresAt).Error
+	if err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) DeleteExpiredSigningKeys(now time.Time) error {
+	err := r.DB.Where("expires_at <= ?", now).Unscoped().Delete(&entities.SigningKey{}).Error
+	if err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
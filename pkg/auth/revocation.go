@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How long the in-memory copy of the revocation table is trusted before it is
+// reloaded, which bounds how late other instances notice a logout.
+const revocationReloadInterval = time.Minute
+
+type revocationCache struct {
+	reloading int32
+
+	mu       sync.RWMutex
+	tokens   map[string]time.Time
+	users    map[uint]time.Time
+	loadedAt time.Time
+}
+
+func newRevocationCache() *revocationCache {
+	return &revocationCache{
+		tokens: map[string]time.Time{},
+		users:  map[uint]time.Time{},
+	}
+}
+
+func (c *revocationCache) add(revoked *entities.RevokedToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if revoked.JTI != "" {
+		c.tokens[revoked.JTI] = revoked.ExpiresAt
+		return
+	}
+	if revoked.IssuedBefore.After(c.users[revoked.UserID]) {
+		c.users[revoked.UserID] = revoked.IssuedBefore
+	}
+}
+
+// isRevoked compares issuedAt with the cutoff of the user to the microsecond,
+// so a token issued right after a logout in the same second stays valid.
+// Tokens from before iat had fractions are cut to the second, which only
+// ever makes them look older.
+func (c *revocationCache) isRevoked(jti string, userID uint, issuedAt float64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, ok := c.tokens[jti]; ok {
+		return true
+	}
+	cutoff, ok := c.users[userID]
+	return ok && issuedAt < numericDate(cutoff)
+}
+
+// numericDate is t in seconds with microseconds, which is as precise as the
+// database keeps the cutoffs.
+func numericDate(t time.Time) float64 {
+	return float64(t.Truncate(time.Microsecond).UnixNano()) / float64(time.Second)
+}
+
+func (c *revocationCache) stale() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return time.Since(c.loadedAt) > revocationReloadInterval
+}
+
+func (c *revocationCache) reload(repo Repository) {
+	if !atomic.CompareAndSwapInt32(&c.reloading, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&c.reloading, 0)
+
+	now := time.Now()
+	if err := repo.DeleteExpiredRevokedTokens(now); err != nil {
+		log.Println("revocations: cleanup failed:", err)
+	}
+	list, err := repo.GetActiveRevokedTokens(now)
+	if err != nil {
+		log.Println("revocations: reload failed:", err)
+		c.mu.Lock()
+		// Retry on the next interval rather than on every request
+		c.loadedAt = now
+		c.mu.Unlock()
+		return
+	}
+
+	fresh := newRevocationCache()
+	for i := range list {
+		fresh.add(&list[i])
+	}
+	c.mu.Lock()
+	// Keep unexpired local entries so a revocation made while the table was
+	// being read is not dropped until the next reload
+	for jti, expiresAt := range c.tokens {
+		if expiresAt.After(now) {
+			fresh.tokens[jti] = expiresAt
+		}
+	}
+	for userID, cutoff := range c.users {
+		if cutoff.After(fresh.users[userID]) && cutoff.Add(AccessTokenTTL()).After(now) {
+			fresh.users[userID] = cutoff
+		}
+	}
+	c.tokens = fresh.tokens
+	c.users = fresh.users
+	c.loadedAt = now
+	c.mu.Unlock()
+}
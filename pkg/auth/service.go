@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"os"
+	"time"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+	challengeTTL           = 5 * time.Minute
+
+	TypeAccess    = "access"
+	TypeChallenge = "2fa"
+)
+
+type Tokens struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type Service interface {
+	IssueTokens(user *entities.User) (*Tokens, error)
+
+	Refresh(refreshToken string) (*Tokens, error)
+
+	Logout(userID uint, jti string, expiresAt time.Time, refreshToken string) error
+
+	LogoutAll(userID uint) error
+
+	IsRevoked(jti string, userID uint, issuedAt float64) bool
+
+	IssueChallenge(user *entities.User) (string, error)
+
+	ConsumeChallenge(challenge string) (uint, error)
+
+	RotateKeys() error
+
+	VerificationKey(token *jwt.Token) (interface{}, error)
+
+	JWKS() *JWKS
+
+	GetRepo() Repository
+}
+
+type service struct {
+	repo        Repository
+	revocations *revocationCache
+	keys        *keyring
+}
+
+// NewService returns the auth service. RotateKeys has to run before it can
+// issue any token.
+func NewService(r Repository) Service {
+	return &service{
+		repo:        r,
+		revocations: newRevocationCache(),
+		keys:        &keyring{},
+	}
+}
+
+// IssueTokens starts a new session for user with a fresh refresh token family.
+func (s *service) IssueTokens(user *entities.User) (*Tokens, error) {
+	family, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	refresh, raw, err := newRefreshToken(user.ID, family)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.CreateRefreshToken(refresh); err != nil {
+		return nil, err
+	}
+	return s.tokensFor(user, raw)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token of the same family. Presenting a refresh token that was already
+// rotated means it leaked, so the whole family is revoked.
+func (s *service) Refresh(refreshToken string) (*Tokens, error) {
+	current, err := s.repo.FindRefreshToken(hashToken(refreshToken))
+	if err == pkg.ErrNotFound {
+		return nil, pkg.ErrRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Revoked {
+		if err := s.repo.RevokeTokenFamily(current.Family); err != nil {
+			return nil, err
+		}
+		return nil, pkg.ErrTokenReuse
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return nil, pkg.ErrRefreshToken
+	}
+
+	user, err := s.repo.FindUserByID(current.UserID)
+	if err != nil {
+		return nil, pkg.ErrRefreshToken
+	}
+	if user.Suspended {
+		return nil, pkg.ErrSuspended
+	}
+
+	next, raw, err := newRefreshToken(user.ID, current.Family)
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.repo.RotateRefreshToken(current, next)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		if err := s.repo.RevokeTokenFamily(current.Family); err != nil {
+			return nil, err
+		}
+		return nil, pkg.ErrTokenReuse
+	}
+	return s.tokensFor(user, raw)
+}
+
+// Logout revokes the access token identified by jti and, when given, the
+// refresh token family the session was started with.
+func (s *service) Logout(userID uint, jti string, expiresAt time.Time, refreshToken string) error {
+	if refreshToken != "" {
+		current, err := s.repo.FindRefreshToken(hashToken(refreshToken))
+		if err != nil && err != pkg.ErrNotFound {
+			return err
+		}
+		if current != nil && current.UserID == userID {
+			if err := s.repo.RevokeTokenFamily(current.Family); err != nil {
+				return err
+			}
+		}
+	}
+	if jti == "" {
+		return nil
+	}
+	return s.revoke(&entities.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// LogoutAll ends every session of the user, on every device.
+func (s *service) LogoutAll(userID uint) error {
+	if err := s.repo.RevokeUserRefreshTokens(userID); err != nil {
+		return err
+	}
+	now := time.Now()
+	return s.revoke(&entities.RevokedToken{
+		UserID:       userID,
+		IssuedBefore: now,
+		ExpiresAt:    now.Add(AccessTokenTTL()),
+	})
+}
+
+func (s *service) IsRevoked(jti string, userID uint, issuedAt float64) bool {
+	if s.revocations.stale() {
+		s.revocations.reload(s.repo)
+	}
+	return s.revocations.isRevoked(jti, userID, issuedAt)
+}
+
+// IssueChallenge returns the short lived token a user with two factor
+// authentication gets after their password checked out. It only proves the
+// first factor and cannot be used as an access token.
+func (s *service) IssueChallenge(user *entities.User) (string, error) {
+	jti, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return s.sign(jwt.MapClaims{
+		"id":  user.ID,
+		"typ": TypeChallenge,
+		"jti": jti,
+		"iat": numericDate(now),
+		"exp": now.Add(challengeTTL).Unix(),
+	})
+}
+
+// ConsumeChallenge checks a challenge token and returns the user it was issued
+// to. Each challenge can only be used once, whether the second factor that
+// comes with it turns out right or not.
+func (s *service) ConsumeChallenge(challenge string) (uint, error) {
+	token, err := jwt.Parse(challenge, s.VerificationKey)
+	if err != nil || !token.Valid {
+		return 0, pkg.ErrTwoFactor
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != TypeChallenge {
+		return 0, pkg.ErrTwoFactor
+	}
+	jti, _ := claims["jti"].(string)
+	id, _ := claims["id"].(float64)
+	iat, _ := claims["iat"].(float64)
+	exp, _ := claims["exp"].(float64)
+	if jti == "" || s.IsRevoked(jti, uint(id), iat) {
+		return 0, pkg.ErrTwoFactor
+	}
+
+	err = s.revoke(&entities.RevokedToken{
+		JTI:       jti,
+		UserID:    uint(id),
+		ExpiresAt: time.Unix(int64(exp), 0),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uint(id), nil
+}
+
+func (s *service) revoke(revoked *entities.RevokedToken) error {
+	if err := s.repo.CreateRevokedToken(revoked); err != nil {
+		return err
+	}
+	s.revocations.add(revoked)
+	return nil
+}
+
+func (s *service) GetRepo() Repository {
+	return s.repo
+}
+
+func (s *service) tokensFor(user *entities.User, refreshToken string) (*Tokens, error) {
+	jti, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL())
+	tokenString, err := s.sign(jwt.MapClaims{
+		"id":   user.ID,
+		"role": roleOf(user),
+		"typ":  TypeAccess,
+		"jti":  jti,
+		"iat":  numericDate(now),
+		"exp":  expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{
+		AccessToken:  tokenString,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+func roleOf(user *entities.User) string {
+	if user.Role == "" {
+		return entities.RoleUser
+	}
+	return user.Role
+}
+
+func newRefreshToken(userID uint, family string) (*entities.RefreshToken, string, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	return &entities.RefreshToken{
+		UserID:    userID,
+		TokenHash: hashToken(raw),
+		Family:    family,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL()),
+	}, raw, nil
+}
+
+func AccessTokenTTL() time.Duration {
+	return durationFromEnv("accessTokenTTL", defaultAccessTokenTTL)
+}
+
+func RefreshTokenTTL() time.Duration {
+	return durationFromEnv("refreshTokenTTL", defaultRefreshTokenTTL)
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,86 @@
+package entities
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"unique_index"`
+	Family    string `gorm:"index"`
+	ExpiresAt time.Time
+	Revoked   bool
+}
+
+// RevokedToken blacklists a single access token by its JTI, or every access
+// token issued to UserID up to IssuedBefore when JTI is empty. Rows are only
+// kept until ExpiresAt, after which the tokens they cover have expired anyway.
+type RevokedToken struct {
+	gorm.Model
+	JTI          string `gorm:"index"`
+	UserID       uint   `gorm:"index"`
+	IssuedBefore time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+type PasswordResetToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"unique_index"`
+	ExpiresAt time.Time
+	Used      bool
+}
+
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint `gorm:"index"`
+	CodeHash string
+	Used     bool
+}
+
+// LoginThrottle counts failed logins for one email address or IP address,
+// identified by Key.
+type LoginThrottle struct {
+	gorm.Model
+	Key           string `gorm:"unique_index"`
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// SigningKey is a key pair access tokens are signed with, identified in the
+// token header by KID. The newest key whose ActivatesAt has passed signs new
+// tokens, older ones only verify until ExpiresAt. Keys are published before
+// they activate so verifiers caching the JWKS already know them.
+type SigningKey struct {
+	gorm.Model
+	KID         string `gorm:"unique_index"`
+	Algorithm   string
+	PrivateKey  string
+	PublicKey   string
+	ActivatesAt time.Time
+	ExpiresAt   *time.Time `gorm:"index"`
+}
+
+// UserIdentity links an account at an external OpenID Connect provider,
+// identified by the provider's subject, to a user.
+type UserIdentity struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	Provider string `gorm:"unique_index:idx_provider_subject"`
+	Subject  string `gorm:"unique_index:idx_provider_subject"`
+	Email    string
+}
+
+// LoginState remembers an OpenID Connect login between sending the user to
+// the provider and the provider sending them back.
+type LoginState struct {
+	gorm.Model
+	State        string `gorm:"unique_index"`
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time `gorm:"index"`
+}
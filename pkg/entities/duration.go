@@ -0,0 +1,78 @@
+package entities
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Duration is a span of time in whole seconds, written as an ISO-8601
+// duration like "PT1H30M" in JSON.
+type Duration int
+
+var durationRe = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// ParseDuration reads ISO-8601 durations made of days, hours, minutes and
+// seconds, e.g. "PT45M" or "P1DT2H".
+func ParseDuration(value string) (Duration, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	match := durationRe.FindStringSubmatch(value)
+	if match == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, pkg.ErrDuration
+	}
+	seconds := 0
+	for i, unit := range []int{24 * 60 * 60, 60 * 60, 60, 1} {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return 0, pkg.ErrDuration
+		}
+		seconds += n * unit
+	}
+	return Duration(seconds), nil
+}
+
+// String writes the duration in hours, minutes and seconds, so two days are
+// "PT48H".
+func (d Duration) String() string {
+	if d <= 0 {
+		return "PT0S"
+	}
+	var b strings.Builder
+	b.WriteString("PT")
+	hours, minutes, seconds := int(d)/3600, int(d)%3600/60, int(d)%60
+	if hours > 0 {
+		fmt.Fprintf(&b, "%dH", hours)
+	}
+	if minutes > 0 {
+		fmt.Fprintf(&b, "%dM", minutes)
+	}
+	if seconds > 0 {
+		fmt.Fprintf(&b, "%dS", seconds)
+	}
+	return b.String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON only takes ISO-8601 durations. A bare number is refused
+// rather than guessed at, forms read it as minutes.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return pkg.ErrDuration
+	}
+	parsed, err := ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,22 @@
+package entities
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+const (
+	ExportPending    = "pending"
+	ExportProcessing = "processing"
+	ExportReady      = "ready"
+	ExportFailed     = "failed"
+)
+
+type DataExport struct {
+	gorm.Model
+	UserID    uint       `json:"user_id" gorm:"index"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	FilePath  string     `json:"-"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
@@ -0,0 +1,22 @@
+package entities
+
+import "github.com/jinzhu/gorm"
+
+// ImageDeletion is a stored image that is no longer referenced and still has
+// to be deleted from the image host.
+type ImageDeletion struct {
+	gorm.Model
+	PublicID  string
+	Attempts  int
+	LastError string
+}
+
+// ImageVariants are the urls of the scaled down copies of an image. Widths
+// the image does not reach have the url of the image itself, images from
+// before scaling have none.
+type ImageVariants struct {
+	Thumbnail string `json:"thumbnail"`
+	Small     string `json:"small"`
+	Medium    string `json:"medium"`
+	Large     string `json:"large"`
+}
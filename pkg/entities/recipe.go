@@ -1,22 +1,125 @@
 package entities
 
-import "github.com/jinzhu/gorm"
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Who can see a recipe besides its author
+const (
+	VisibilityDraft     = "draft"
+	VisibilityPrivate   = "private"
+	VisibilityFollowers = "followers"
+	VisibilityPublic    = "public"
+)
 
 type Recipe struct {
 	gorm.Model
-	UserID      uint         `json:"user_id"`
-	RecipeName  string       `json:"recipe_name"`
-	Description string       `json:"description"`
-	Ingredients string       `json:"ingredients"`
-	Difficulty  int          `json:"difficulty"`
-	Procedure   string       `json:"procedure"`
-	ImgUrl      string       `json:"img_url"`
-	ImgPublicId string       `json:"-"`
-	Name        string       `json:"name"`
-	Username    string       `json:"username"`
-	UserImg     string       `json:"user_img"`
-	Likes       int          `json:"likes"`
-	LikeDetails []LikeDetail `json:"-" gorm:"foreignkey:RecipeID"`
+	UserID      uint          `json:"user_id"`
+	RecipeName  string        `json:"recipe_name"`
+	Description string        `json:"description"`
+	Ingredients []Ingredient  `json:"ingredients" gorm:"foreignkey:RecipeID"`
+	Difficulty  int           `json:"difficulty"`
+	Servings    int           `json:"servings"`
+	PrepTime    Duration      `json:"prep_time"`
+	CookTime    Duration      `json:"cook_time"`
+	RestTime    Duration      `json:"rest_time"`
+	TotalTime   Duration      `json:"total_time" gorm:"index"`
+	Steps       []Step        `json:"steps" gorm:"foreignkey:RecipeID"`
+	Tags        []Tag         `json:"tags" gorm:"many2many:recipe_tags"`
+	Images      []RecipeImage `json:"images" gorm:"foreignkey:RecipeID"`
+	ImgUrl      string        `json:"img_url"`
+	ImgPublicId string        `json:"-"`
+	ImgVariants ImageVariants `json:"img_variants" gorm:"embedded;embedded_prefix:img_"`
+	Name        string        `json:"name"`
+	Username    string        `json:"username"`
+	UserImg     string        `json:"user_img"`
+	Likes       int           `json:"likes"`
+	LikeDetails []LikeDetail  `json:"-" gorm:"foreignkey:RecipeID"`
+
+	// Set on forks to the recipe they were adapted from, which may since have
+	// been deleted. The username is kept so the fork still credits its author.
+	ForkedFromID       *uint  `json:"forked_from_id" gorm:"index"`
+	ForkedFromUsername string `json:"forked_from_username"`
+
+	// A recipe with PublishAt set stays hidden until the scheduler publishes
+	// it then. PublishedAt is when others could first see it, listings are
+	// ordered by it.
+	Visibility  string     `json:"visibility" gorm:"default:'public';index"`
+	PublishAt   *time.Time `json:"publish_at" gorm:"index"`
+	PublishedAt *time.Time `json:"published_at" gorm:"index"`
+
+	// Estimated from the ingredients whenever they change. Coverage is the
+	// share of measured ingredients that could be matched to a food, per
+	// serving figures stay zero while servings are unknown.
+	Nutrition           Nutrition `json:"nutrition" gorm:"embedded;embedded_prefix:nutrition_"`
+	NutritionPerServing Nutrition `json:"nutrition_per_serving" gorm:"embedded;embedded_prefix:serving_nutrition_"`
+	NutritionCoverage   float64   `json:"nutrition_coverage"`
+	NutritionVersion    int       `json:"-"`
+
+	// Computed from the ingredients like nutrition, the author can add labels
+	// the ingredients do not earn or remove ones they do
+	DietaryLabels  pq.StringArray `json:"dietary_labels" gorm:"type:text[]"`
+	Allergens      pq.StringArray `json:"allergens" gorm:"type:text[]"`
+	AddedLabels    pq.StringArray `json:"added_labels" gorm:"type:text[]"`
+	RemovedLabels  pq.StringArray `json:"removed_labels" gorm:"type:text[]"`
+	DietaryVersion string         `json:"-"`
+
+	// Free text ingredients and procedure from before they were structured,
+	// emptied once they have been parsed into Ingredients and Steps
+	LegacyIngredients string `json:"-" gorm:"column:ingredients"`
+	LegacyProcedure   string `json:"-" gorm:"column:procedure"`
+}
+
+// Ingredient is one line of the ingredient list of a recipe. Quantity is nil
+// for things like "salt to taste", Group names the part of the recipe the
+// ingredient belongs to, e.g. "for the sauce".
+type Ingredient struct {
+	gorm.Model
+	RecipeID uint     `json:"-" gorm:"index"`
+	Position int      `json:"position"`
+	Name     string   `json:"name"`
+	Quantity *float64 `json:"quantity"`
+	Unit     string   `json:"unit"`
+	Note     string   `json:"note"`
+	Group    string   `json:"group" gorm:"column:group_name"`
+}
+
+// Step is one step of the procedure of a recipe. DurationSeconds is set when
+// the step involves waiting, for the timers of cooking mode.
+type Step struct {
+	gorm.Model
+	RecipeID        uint          `json:"-" gorm:"index"`
+	Position        int           `json:"position"`
+	Text            string        `json:"text"`
+	DurationSeconds int           `json:"duration_seconds"`
+	ImgUrl          string        `json:"img_url"`
+	ImgPublicId     string        `json:"-"`
+	ImgVariants     ImageVariants `json:"img_variants" gorm:"embedded;embedded_prefix:img_"`
+}
+
+// RecipeImage is one image of the gallery of a recipe. Exactly one image of a
+// recipe is the cover, whose url is also kept in Recipe.ImgUrl for the
+// listings.
+type RecipeImage struct {
+	gorm.Model
+	RecipeID    uint          `json:"-" gorm:"index"`
+	Position    int           `json:"position"`
+	ImgUrl      string        `json:"img_url"`
+	ImgPublicId string        `json:"-"`
+	ImgVariants ImageVariants `json:"img_variants" gorm:"embedded;embedded_prefix:img_"`
+	AltText     string        `json:"alt_text"`
+	Cover       bool          `json:"cover"`
+}
+
+// Nutrition is energy in kcal and macronutrients in grams
+type Nutrition struct {
+	Calories      float64 `json:"calories"`
+	Protein       float64 `json:"protein"`
+	Fat           float64 `json:"fat"`
+	Carbohydrates float64 `json:"carbohydrates"`
+	Fiber         float64 `json:"fiber"`
 }
 
 type LikeDetail struct {
@@ -0,0 +1,55 @@
+package entities
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// RecipeRevision is the content of a recipe after one of its edits, numbered
+// from 1 for every recipe. Revisions are never changed, restoring one saves
+// its content again as the newest revision.
+type RecipeRevision struct {
+	gorm.Model
+	RecipeID uint            `json:"recipe_id" gorm:"unique_index:idx_revision_recipe_number"`
+	Number   int             `json:"number" gorm:"unique_index:idx_revision_recipe_number"`
+	Content  RevisionContent `json:"content" gorm:"type:text"`
+}
+
+// RevisionContent is what authors edit of a recipe. Images are edited on
+// their own and are not part of revisions.
+type RevisionContent struct {
+	RecipeName    string         `json:"recipe_name"`
+	Description   string         `json:"description"`
+	Ingredients   []Ingredient   `json:"ingredients"`
+	Difficulty    int            `json:"difficulty"`
+	Servings      int            `json:"servings"`
+	PrepTime      Duration       `json:"prep_time"`
+	CookTime      Duration       `json:"cook_time"`
+	RestTime      Duration       `json:"rest_time"`
+	Steps         []Step         `json:"steps"`
+	Tags          []Tag          `json:"tags"`
+	AddedLabels   pq.StringArray `json:"added_labels"`
+	RemovedLabels pq.StringArray `json:"removed_labels"`
+}
+
+// Value stores the content as JSON.
+func (c RevisionContent) Value() (driver.Value, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (c *RevisionContent) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, c)
+	case string:
+		return json.Unmarshal([]byte(data), c)
+	}
+	return errors.New("entities: cannot scan revision content")
+}
@@ -0,0 +1,21 @@
+package entities
+
+import "github.com/jinzhu/gorm"
+
+// Kinds of tags. Free tags are made up by authors, the others come from the
+// curated vocabularies of package recipe.
+const (
+	TagFree     = "tag"
+	TagCuisine  = "cuisine"
+	TagCourse   = "course"
+	TagMealType = "meal_type"
+)
+
+// Tag classifies recipes. Tags are looked up by kind and slug, the lower case
+// and dashed form of the name.
+type Tag struct {
+	gorm.Model
+	Kind string `json:"kind" gorm:"unique_index:idx_tag_kind_slug"`
+	Slug string `json:"slug" gorm:"unique_index:idx_tag_kind_slug"`
+	Name string `json:"name"`
+}
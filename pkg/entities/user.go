@@ -2,6 +2,15 @@ package entities
 
 import (
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+
+	DefaultProfileImgUrl = "https://res.cloudinary.com/dvn1hxflu/image/upload/v1587624171/blank-profile-picture-973460_640_bgnkjn.png"
 )
 
 type User struct {
@@ -13,10 +22,18 @@ type User struct {
 	Password           string           `json:"password"`
 	ProfileImgUrl      string           `json:"profile_img_url"`
 	ProfileImgPublicID string           `json:"-"`
+	ProfileImgVariants ImageVariants    `json:"profile_img_variants" gorm:"embedded;embedded_prefix:profile_img_"`
 	FollowingCount     uint             `json:"following"`
 	FollowersCount     uint             `json:"followers"`
 	Bio                string           `json:"bio"`
 	Verified           bool             `json:"verified"`
+	VerificationSentAt *time.Time       `json:"-"`
+	Role               string           `json:"role" gorm:"default:'user'"`
+	Suspended          bool             `json:"suspended"`
+	TwoFactorEnabled   bool             `json:"two_factor_enabled"`
+	TOTPSecret         string           `json:"-"`
+	TOTPLastStep       int64            `json:"-"`
+	DietaryPreferences pq.StringArray   `json:"dietary_preferences" gorm:"type:text[]"`
 	Recipes            []Recipe         `json:"-" gorm:"foreignkey:UserID"`
 	FavouriteRecipes   []FavoriteRecipe `json:"-" gorm:"foreignkey:UserID"`
 	Following          []Following      `json:"-" gorm:"foreignkey:UserID"`
@@ -13,4 +13,36 @@ var (
 	ErrForbidden    = errors.New("Error: Access to this resource is forbidden")
 	ErrEmail        = errors.New("Error: Email not valid")
 	ErrPassword     = errors.New("Error: Password must be greater than 6 chars")
+	ErrRefreshToken = errors.New("Error: Refresh token is invalid or expired")
+	ErrTokenReuse   = errors.New("Error: Refresh token was already used, please login again")
+	ErrResetToken   = errors.New("Error: Password reset link is invalid or expired")
+	ErrVerifyToken  = errors.New("Error: Verification link is invalid or expired")
+	ErrNotVerified  = errors.New("Error: Please verify your email first")
+	ErrTooMany      = errors.New("Error: Too many requests, please try again later")
+	ErrWrongPass    = errors.New("Error: Current password is incorrect")
+	ErrSuspended    = errors.New("Error: This account has been suspended")
+	ErrNotReady     = errors.New("Error: Export is not ready yet")
+	ErrTwoFactor    = errors.New("Error: Invalid two factor code")
+	ErrTwoFactorOn  = errors.New("Error: Two factor authentication is already enabled")
+	ErrTwoFactorOff = errors.New("Error: Two factor authentication is not set up")
+	ErrLocked       = errors.New("Error: Too many failed login attempts, please try again later")
+	ErrSigningKey   = errors.New("Error: No signing key available")
+	ErrProvider     = errors.New("Error: Unknown login provider")
+	ErrLoginState   = errors.New("Error: Login request is invalid or expired")
+	ErrProviderAuth = errors.New("Error: Login with the provider failed")
+	ErrNoEmail      = errors.New("Error: The provider did not confirm an email address")
+	ErrLinkAccount  = errors.New("Error: An account with this email exists, please verify it before signing in with a provider")
+	ErrIngredients  = errors.New("Error: Ingredients are not valid")
+	ErrSteps        = errors.New("Error: Steps are not valid")
+	ErrServings     = errors.New("Error: Servings are not valid for this recipe")
+	ErrUnits        = errors.New("Error: Units must be metric or us")
+	ErrTags         = errors.New("Error: Tags are not valid")
+	ErrDietary      = errors.New("Error: Dietary labels are not valid")
+	ErrDuration     = errors.New("Error: Times must be ISO-8601 durations, or minutes in form fields")
+	ErrSort         = errors.New("Error: Sort order is not valid")
+	ErrImages       = errors.New("Error: Images are not valid")
+	ErrImageType    = errors.New("Error: Images must be JPEG, PNG or GIF files")
+	ErrImageSize    = errors.New("Error: Image is too large")
+	ErrForkOwn      = errors.New("Error: You can not fork your own recipe")
+	ErrVisibility   = errors.New("Error: Visibility or publish time is not valid")
 )
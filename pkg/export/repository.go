@@ -0,0 +1,238 @@
+package export
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"time"
+)
+
+type Repository interface {
+	FindUserByID(id uint) (*entities.User, error)
+
+	CountUserData(userID uint) (int, error)
+
+	GetRecipesOfUser(userID uint) ([]entities.Recipe, error)
+
+	GetFavoriteRecipes(userID uint) ([]entities.FavoriteRecipe, []entities.Recipe, error)
+
+	GetLikedRecipes(userID uint) ([]entities.LikeDetail, []entities.Recipe, error)
+
+	GetFollowers(userID uint) ([]entities.Follower, []entities.User, error)
+
+	GetFollowing(userID uint) ([]entities.Following, []entities.User, error)
+
+	CreateExport(export *entities.DataExport) (*entities.DataExport, error)
+
+	UpdateExport(export *entities.DataExport) (*entities.DataExport, error)
+
+	FindExport(id, userID uint) (*entities.DataExport, error)
+
+	FindActiveExport(userID uint) (*entities.DataExport, error)
+
+	GetUnfinishedExports() ([]entities.DataExport, error)
+
+	GetExpiredExports(now time.Time) ([]entities.DataExport, error)
+
+	DeleteExport(export *entities.DataExport) error
+}
+
+type repo struct {
+	DB *gorm.DB
+}
+
+func NewRepo(db *gorm.DB) Repository {
+	return &repo{
+		DB: db,
+	}
+}
+
+func (r *repo) FindUserByID(id uint) (*entities.User, error) {
+	user := &entities.User{}
+	r.DB.Where("id = ?", id).First(user)
+	if user.Email == "" {
+		return nil, pkg.ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *repo) CountUserData(userID uint) (int, error) {
+	total := 0
+	for _, model := range []interface{}{
+		&entities.Recipe{},
+		&entities.FavoriteRecipe{},
+		&entities.LikeDetail{},
+		&entities.Follower{},
+		&entities.Following{},
+	} {
+		count := 0
+		if err := r.DB.Model(model).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return 0, pkg.ErrDatabase
+		}
+		total += count
+	}
+	return total, nil
+}
+
+func (r *repo) GetRecipesOfUser(userID uint) ([]entities.Recipe, error) {
+	var recipes []entities.Recipe
+	err := r.DB.Preload("Ingredients", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	}).Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	}).Preload("Images", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	}).Preload("Tags").Where("user_id = ?", userID).Order("created_at asc").Find(&recipes).Error
+	if err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return recipes, nil
+}
+
+func (r *repo) GetFavoriteRecipes(userID uint) ([]entities.FavoriteRecipe, []entities.Recipe, error) {
+	var favs []entities.FavoriteRecipe
+	if err := r.DB.Where("user_id = ?", userID).Order("created_at asc").Find(&favs).Error; err != nil {
+		return nil, nil, pkg.ErrDatabase
+	}
+	var recipeIDs []uint
+	for _, fav := range favs {
+		recipeIDs = append(recipeIDs, fav.RecipeID)
+	}
+	recipes, err := r.findRecipes(recipeIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return favs, recipes, nil
+}
+
+func (r *repo) GetLikedRecipes(userID uint) ([]entities.LikeDetail, []entities.Recipe, error) {
+	var likes []entities.LikeDetail
+	if err := r.DB.Where("user_id = ?", userID).Order("created_at asc").Find(&likes).Error; err != nil {
+		return nil, nil, pkg.ErrDatabase
+	}
+	var recipeIDs []uint
+	for _, like := range likes {
+		recipeIDs = append(recipeIDs, like.RecipeID)
+	}
+	recipes, err := r.findRecipes(recipeIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return likes, recipes, nil
+}
+
+func (r *repo) GetFollowers(userID uint) ([]entities.Follower, []entities.User, error) {
+	var followers []entities.Follower
+	if err := r.DB.Where("user_id = ?", userID).Order("created_at asc").Find(&followers).Error; err != nil {
+		return nil, nil, pkg.ErrDatabase
+	}
+	var userIDs []uint
+	for _, follower := range followers {
+		userIDs = append(userIDs, follower.OthersUserID)
+	}
+	users, err := r.findUsers(userIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return followers, users, nil
+}
+
+func (r *repo) GetFollowing(userID uint) ([]entities.Following, []entities.User, error) {
+	var followings []entities.Following
+	if err := r.DB.Where("user_id = ?", userID).Order("created_at asc").Find(&followings).Error; err != nil {
+		return nil, nil, pkg.ErrDatabase
+	}
+	var userIDs []uint
+	for _, following := range followings {
+		userIDs = append(userIDs, following.OthersUserID)
+	}
+	users, err := r.findUsers(userIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return followings, users, nil
+}
+
+func (r *repo) CreateExport(export *entities.DataExport) (*entities.DataExport, error) {
+	if err := r.DB.Create(export).Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return export, nil
+}
+
+func (r *repo) UpdateExport(export *entities.DataExport) (*entities.DataExport, error) {
+	if err := r.DB.Save(export).Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return export, nil
+}
+
+func (r *repo) FindExport(id, userID uint) (*entities.DataExport, error) {
+	export := &entities.DataExport{}
+	result := r.DB.Where("id = ? and user_id = ?", id, userID).First(export)
+	if result.RecordNotFound() {
+		return nil, pkg.ErrNotFound
+	}
+	if result.Error != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return export, nil
+}
+
+func (r *repo) FindActiveExport(userID uint) (*entities.DataExport, error) {
+	export := &entities.DataExport{}
+	result := r.DB.Where("user_id = ? and status in (?)", userID, []string{entities.ExportPending, entities.ExportProcessing}).First(export)
+	if result.RecordNotFound() {
+		return nil, pkg.ErrNotFound
+	}
+	if result.Error != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return export, nil
+}
+
+func (r *repo) GetUnfinishedExports() ([]entities.DataExport, error) {
+	var exports []entities.DataExport
+	err := r.DB.Where("status in (?)", []string{entities.ExportPending, entities.ExportProcessing}).Find(&exports).Error
+	if err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return exports, nil
+}
+
+func (r *repo) GetExpiredExports(now time.Time) ([]entities.DataExport, error) {
+	var exports []entities.DataExport
+	if err := r.DB.Where("expires_at <= ?", now).Find(&exports).Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return exports, nil
+}
+
+func (r *repo) DeleteExport(export *entities.DataExport) error {
+	if err := r.DB.Unscoped().Delete(export).Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) findRecipes(ids []uint) ([]entities.Recipe, error) {
+	var recipes []entities.Recipe
+	if len(ids) == 0 {
+		return recipes, nil
+	}
+	if err := r.DB.Where("id in (?)", ids).Find(&recipes).Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return recipes, nil
+}
+
+func (r *repo) findUsers(ids []uint) ([]entities.User, error) {
+	var users []entities.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	if err := r.DB.Where("id in (?)", ids).Find(&users).Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return users, nil
+}
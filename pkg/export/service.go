@@ -0,0 +1,309 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// Accounts with fewer rows than this are exported within the request
+	syncExportLimit = 500
+
+	exportTTL = 7 * 24 * time.Hour
+)
+
+type RecipeRef struct {
+	RecipeID       uint      `json:"recipe_id"`
+	RecipeName     string    `json:"recipe_name"`
+	AuthorUsername string    `json:"author_username"`
+	At             time.Time `json:"at"`
+}
+
+type UserRef struct {
+	UserID   uint      `json:"user_id"`
+	Name     string    `json:"name"`
+	Username string    `json:"username"`
+	Since    time.Time `json:"since"`
+}
+
+type Service interface {
+	RequestExport(userID uint) (*entities.DataExport, error)
+
+	GetExport(exportID, userID uint) (*entities.DataExport, error)
+
+	GetArchivePath(exportID, userID uint) (string, error)
+
+	ResumeUnfinishedExports() error
+
+	DeleteExpiredExports() error
+
+	GetRepo() Repository
+}
+
+type service struct {
+	repo Repository
+	dir  string
+}
+
+func NewService(r Repository, dir string) Service {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "socialrecipe-exports")
+	}
+	return &service{
+		repo: r,
+		dir:  dir,
+	}
+}
+
+// RequestExport starts building the data archive of the user. Small accounts
+// get a ready export back straight away, larger ones are built in the
+// background and have to be polled with GetExport.
+func (s *service) RequestExport(userID uint) (*entities.DataExport, error) {
+	active, err := s.repo.FindActiveExport(userID)
+	if err == nil {
+		return active, nil
+	}
+	if err != pkg.ErrNotFound {
+		return nil, err
+	}
+
+	count, err := s.repo.CountUserData(userID)
+	if err != nil {
+		return nil, err
+	}
+	export, err := s.repo.CreateExport(&entities.DataExport{
+		UserID: userID,
+		Status: entities.ExportPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if count < syncExportLimit {
+		return s.build(export)
+	}
+	go func() {
+		if _, err := s.build(export); err != nil {
+			log.Printf("export %d failed: %s", export.ID, err.Error())
+		}
+	}()
+	return export, nil
+}
+
+func (s *service) GetExport(exportID, userID uint) (*entities.DataExport, error) {
+	return s.repo.FindExport(exportID, userID)
+}
+
+func (s *service) GetArchivePath(exportID, userID uint) (string, error) {
+	export, err := s.repo.FindExport(exportID, userID)
+	if err != nil {
+		return "", err
+	}
+	if export.Status != entities.ExportReady {
+		return "", pkg.ErrNotReady
+	}
+	return export.FilePath, nil
+}
+
+// ResumeUnfinishedExports restarts exports that were cut short by a restart.
+func (s *service) ResumeUnfinishedExports() error {
+	exports, err := s.repo.GetUnfinishedExports()
+	if err != nil {
+		return err
+	}
+	for i := range exports {
+		export := exports[i]
+		go func() {
+			if _, err := s.build(&export); err != nil {
+				log.Printf("export %d failed: %s", export.ID, err.Error())
+			}
+		}()
+	}
+	return nil
+}
+
+func (s *service) DeleteExpiredExports() error {
+	exports, err := s.repo.GetExpiredExports(time.Now())
+	if err != nil {
+		return err
+	}
+	for i := range exports {
+		if exports[i].FilePath != "" {
+			if err := os.Remove(exports[i].FilePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("removing export %d failed: %s", exports[i].ID, err.Error())
+				continue
+			}
+		}
+		if err := s.repo.DeleteExport(&exports[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) GetRepo() Repository {
+	return s.repo
+}
+
+func (s *service) build(export *entities.DataExport) (*entities.DataExport, error) {
+	export.Status = entities.ExportProcessing
+	if _, err := s.repo.UpdateExport(export); err != nil {
+		return nil, err
+	}
+
+	path, err := s.writeArchive(export)
+	if err != nil {
+		expiresAt := time.Now().Add(exportTTL)
+		export.Status = entities.ExportFailed
+		export.Error = "Building the archive failed, please request a new export"
+		export.ExpiresAt = &expiresAt
+		_, _ = s.repo.UpdateExport(export)
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(exportTTL)
+	export.Status = entities.ExportReady
+	export.FilePath = path
+	export.ExpiresAt = &expiresAt
+	return s.repo.UpdateExport(export)
+}
+
+func (s *service) writeArchive(export *entities.DataExport) (string, error) {
+	files, err := s.collect(export.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("export-%d-%d.zip", export.UserID, export.ID))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for _, name := range []string{"profile.json", "recipes.json", "favourites.json", "likes.json", "followers.json", "following.json"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			return "", err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(files[name]); err != nil {
+			return "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (s *service) collect(userID uint) (map[string]interface{}, error) {
+	user, err := s.repo.FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+
+	recipes, err := s.repo.GetRecipesOfUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	favs, favRecipes, err := s.repo.GetFavoriteRecipes(userID)
+	if err != nil {
+		return nil, err
+	}
+	favByID := recipesByID(favRecipes)
+	favourites := make([]RecipeRef, 0, len(favs))
+	for _, fav := range favs {
+		favourites = append(favourites, recipeRef(fav.RecipeID, fav.CreatedAt, favByID))
+	}
+
+	likeDetails, likedRecipes, err := s.repo.GetLikedRecipes(userID)
+	if err != nil {
+		return nil, err
+	}
+	likedByID := recipesByID(likedRecipes)
+	likes := make([]RecipeRef, 0, len(likeDetails))
+	for _, like := range likeDetails {
+		likes = append(likes, recipeRef(like.RecipeID, like.CreatedAt, likedByID))
+	}
+
+	followerRows, followerUsers, err := s.repo.GetFollowers(userID)
+	if err != nil {
+		return nil, err
+	}
+	followersByID := usersByID(followerUsers)
+	followers := make([]UserRef, 0, len(followerRows))
+	for _, follower := range followerRows {
+		followers = append(followers, userRef(follower.OthersUserID, follower.CreatedAt, followersByID))
+	}
+
+	followingRows, followingUsers, err := s.repo.GetFollowing(userID)
+	if err != nil {
+		return nil, err
+	}
+	followingByID := usersByID(followingUsers)
+	following := make([]UserRef, 0, len(followingRows))
+	for _, follow := range followingRows {
+		following = append(following, userRef(follow.OthersUserID, follow.CreatedAt, followingByID))
+	}
+
+	return map[string]interface{}{
+		"profile.json":    user,
+		"recipes.json":    recipes,
+		"favourites.json": favourites,
+		"likes.json":      likes,
+		"followers.json":  followers,
+		"following.json":  following,
+	}, nil
+}
+
+func recipesByID(recipes []entities.Recipe) map[uint]entities.Recipe {
+	byID := make(map[uint]entities.Recipe, len(recipes))
+	for _, recipe := range recipes {
+		byID[recipe.ID] = recipe
+	}
+	return byID
+}
+
+func usersByID(users []entities.User) map[uint]entities.User {
+	byID := make(map[uint]entities.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+	return byID
+}
+
+func recipeRef(recipeID uint, at time.Time, recipes map[uint]entities.Recipe) RecipeRef {
+	recipe := recipes[recipeID]
+	return RecipeRef{
+		RecipeID:       recipeID,
+		RecipeName:     recipe.RecipeName,
+		AuthorUsername: recipe.Username,
+		At:             at,
+	}
+}
+
+// Only public details of other users go into the archive
+func userRef(userID uint, since time.Time, users map[uint]entities.User) UserRef {
+	user := users[userID]
+	return UserRef{
+		UserID:   userID,
+		Name:     user.Name,
+		Username: user.Username,
+		Since:    since,
+	}
+}
@@ -0,0 +1,111 @@
+package imaging
+
+import (
+	"bytes"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// Pixels of the largest image that is decoded, about a 50 megapixel photo
+	maxPixels = 50 * 1000 * 1000
+
+	// Width the stored original is scaled down to
+	maxWidth = 2560
+
+	thumbnailSize = 200
+	jpegQuality   = 85
+)
+
+// Variant names with the width they are scaled down to
+var Widths = []struct {
+	Name  string
+	Width int
+}{
+	{"small", 480},
+	{"medium", 960},
+	{"large", 1600},
+}
+
+// File is an encoded image ready to be stored
+type File struct {
+	Data        []byte
+	ContentType string
+}
+
+// Processed is an upload with its metadata gone. Variants are keyed by name,
+// ones that would be as large as the original are left out.
+type Processed struct {
+	Original  File
+	Thumbnail File
+	Variants  map[string]File
+}
+
+// Process decodes an uploaded image, whatever type the client claimed it to
+// be, and encodes it again without its metadata. Photos are turned upright
+// first, since their EXIF orientation is dropped with the rest. The copies
+// are JPEGs unless the image has transparent parts.
+func Process(data []byte) (*Processed, error) {
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, pkg.ErrImageType
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, pkg.ErrImageType
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, pkg.ErrImageSize
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, pkg.ErrImageType
+	}
+
+	img := image.NewNRGBA(decoded.Bounds().Sub(decoded.Bounds().Min))
+	draw.Draw(img, img.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	img = orient(img, orientation(data))
+	img = fitWidth(img, maxWidth)
+
+	processed := &Processed{Variants: map[string]File{}}
+	opaque := img.Opaque()
+	if processed.Original, err = encode(img, opaque); err != nil {
+		return nil, err
+	}
+	if processed.Thumbnail, err = encode(fitWidth(cropSquare(img), thumbnailSize), opaque); err != nil {
+		return nil, err
+	}
+	// Each variant is scaled from the next larger one, which is much faster
+	// than scaling every one from the original
+	scaled := img
+	for i := len(Widths) - 1; i >= 0; i-- {
+		if Widths[i].Width >= img.Bounds().Dx() {
+			continue
+		}
+		scaled = fitWidth(scaled, Widths[i].Width)
+		if processed.Variants[Widths[i].Name], err = encode(scaled, opaque); err != nil {
+			return nil, err
+		}
+	}
+	return processed, nil
+}
+
+func encode(img image.Image, opaque bool) (File, error) {
+	var buf bytes.Buffer
+	if !opaque {
+		if err := png.Encode(&buf, img); err != nil {
+			return File{}, err
+		}
+		return File{Data: buf.Bytes(), ContentType: "image/png"}, nil
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return File{}, err
+	}
+	return File{Data: buf.Bytes(), ContentType: "image/jpeg"}, nil
+}
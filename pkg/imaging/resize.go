@@ -0,0 +1,71 @@
+package imaging
+
+import "image"
+
+// fitWidth scales img down to width, keeping its aspect ratio. Images that
+// are narrower already are returned as they are.
+func fitWidth(img *image.NRGBA, width int) *image.NRGBA {
+	b := img.Bounds()
+	if b.Dx() <= width {
+		return img
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	return shrink(img, width, height)
+}
+
+// cropSquare cuts the largest square out of the middle of img.
+func cropSquare(img *image.NRGBA) *image.NRGBA {
+	b := img.Bounds()
+	size := b.Dx()
+	if b.Dy() < size {
+		size = b.Dy()
+	}
+	x, y := b.Min.X+(b.Dx()-size)/2, b.Min.Y+(b.Dy()-size)/2
+	return img.SubImage(image.Rect(x, y, x+size, y+size)).(*image.NRGBA)
+}
+
+// shrink scales img down by averaging the source pixels each pixel of the
+// result covers, weighted by their alpha so transparent pixels do not darken
+// the edges around them.
+func shrink(img *image.NRGBA, width, height int) *image.NRGBA {
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := b.Min.Y + (y+1)*b.Dy()/height
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := b.Min.X + (x+1)*b.Dx()/width
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				i := img.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					pa := uint64(img.Pix[i+3])
+					r += uint64(img.Pix[i]) * pa
+					g += uint64(img.Pix[i+1]) * pa
+					bl += uint64(img.Pix[i+2]) * pa
+					a += pa
+					n++
+					i += 4
+				}
+			}
+			j := dst.PixOffset(x, y)
+			if a > 0 {
+				dst.Pix[j] = uint8(r / a)
+				dst.Pix[j+1] = uint8(g / a)
+				dst.Pix[j+2] = uint8(bl / a)
+			}
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+type fileMailer struct {
+	dir string
+
+	mu    sync.Mutex
+	count int
+}
+
+// NewFileMailer returns a Mailer that writes every mail to a file in dir. When
+// dir is empty the mails are only logged.
+func NewFileMailer(dir string) Mailer {
+	return &fileMailer{
+		dir: dir,
+	}
+}
+
+func (m *fileMailer) Send(to, subject, body string) error {
+	msg := message("noreply@localhost", to, subject, body)
+	if m.dir == "" {
+		log.Printf("mailer: mail to %s\n%s", to, msg)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.count++
+	name := fmt.Sprintf("%d-%03d-%s.eml", time.Now().UnixNano(), m.count, unsafeFileChars.ReplaceAllString(to, "_"))
+	m.mu.Unlock()
+	return ioutil.WriteFile(filepath.Join(m.dir, name), msg, 0644)
+}
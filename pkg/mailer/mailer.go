@@ -0,0 +1,23 @@
+package mailer
+
+import "os"
+
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// FromEnv picks the mailer configured by the mailer env variable. Anything
+// other than "smtp" writes mails to mailDir instead of delivering them, which
+// is what local development and tests want.
+func FromEnv() Mailer {
+	if os.Getenv("mailer") == "smtp" {
+		return NewSMTPMailer(
+			os.Getenv("smtpHost"),
+			os.Getenv("smtpPort"),
+			os.Getenv("smtpUser"),
+			os.Getenv("smtpPass"),
+			os.Getenv("mailFrom"),
+		)
+	}
+	return NewFileMailer(os.Getenv("mailDir"))
+}
@@ -0,0 +1,261 @@
+package nutrition
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"hash/fnv"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// What an ingredient can contain. All but meat and honey are allergens.
+const (
+	ContainsMeat      = "meat"
+	ContainsFish      = "fish"
+	ContainsShellfish = "shellfish"
+	ContainsDairy     = "dairy"
+	ContainsEgg       = "egg"
+	ContainsGluten    = "gluten"
+	ContainsTreeNuts  = "tree_nuts"
+	ContainsPeanuts   = "peanuts"
+	ContainsSoy       = "soy"
+	ContainsSesame    = "sesame"
+	ContainsHoney     = "honey"
+)
+
+// Dietary labels, in the order they are listed on recipes
+var Labels = []string{
+	"vegetarian", "vegan", "pescatarian", "gluten_free", "dairy_free",
+	"egg_free", "nut_free", "soy_free",
+}
+
+// What keeps a recipe from carrying each label
+var labelExcludes = map[string][]string{
+	"vegetarian":  {ContainsMeat, ContainsFish, ContainsShellfish},
+	"vegan":       {ContainsMeat, ContainsFish, ContainsShellfish, ContainsDairy, ContainsEgg, ContainsHoney},
+	"pescatarian": {ContainsMeat},
+	"gluten_free": {ContainsGluten},
+	"dairy_free":  {ContainsDairy},
+	"egg_free":    {ContainsEgg},
+	"nut_free":    {ContainsTreeNuts, ContainsPeanuts},
+	"soy_free":    {ContainsSoy},
+}
+
+var allergens = []string{
+	ContainsGluten, ContainsDairy, ContainsEgg, ContainsTreeNuts, ContainsPeanuts,
+	ContainsSoy, ContainsSesame, ContainsFish, ContainsShellfish,
+}
+
+type rule struct {
+	words    []string
+	contains []string
+}
+
+var (
+	rules        = compileRules(defaultRules)
+	rulesVersion = versionOf(defaultRules)
+)
+
+// LoadDietaryRules adds the rules of a JSON file to the default rule table,
+// e.g. {"quorn": ["egg"], "oyster mushroom": []}. A rule in the file replaces
+// the default rule for the same words, an empty list marks words as safe.
+func LoadDietaryRules(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var extra map[string][]string
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return fmt.Errorf("reading dietary rules: %s", err.Error())
+	}
+	table := make(map[string][]string, len(defaultRules)+len(extra))
+	for words, contains := range defaultRules {
+		table[words] = contains
+	}
+	for words, contains := range extra {
+		for _, c := range contains {
+			if !knownContent(c) {
+				return fmt.Errorf("dietary rule %q: unknown content %q", words, c)
+			}
+		}
+		table[words] = contains
+	}
+	rules = compileRules(table)
+	rulesVersion = versionOf(table)
+	return nil
+}
+
+// DietaryVersion identifies the rule table, so labels computed with another
+// table can be recalculated.
+func DietaryVersion() string {
+	return rulesVersion
+}
+
+// Classify sets the dietary labels and allergens of the recipe. A label is
+// given when no ingredient is known to rule it out, then the labels the
+// author added or removed are applied. Labels the author added also count
+// what they rule out as absent for the other labels, but allergens always
+// come from the ingredients, an author cannot hide one.
+func Classify(recipe *entities.Recipe) {
+	contains := make(map[string]bool)
+	for _, ingredient := range recipe.Ingredients {
+		for _, c := range Contents(ingredient.Name) {
+			contains[c] = true
+		}
+	}
+	labelContains := make(map[string]bool, len(contains))
+	for c := range contains {
+		labelContains[c] = true
+	}
+
+	removed := make(map[string]bool, len(recipe.RemovedLabels))
+	for _, label := range recipe.RemovedLabels {
+		removed[label] = true
+	}
+	added := make(map[string]bool, len(recipe.AddedLabels))
+	for _, label := range recipe.AddedLabels {
+		added[label] = true
+		for _, c := range labelExcludes[label] {
+			delete(labelContains, c)
+		}
+	}
+
+	recipe.DietaryLabels = pq.StringArray{}
+	for _, label := range Labels {
+		if removed[label] {
+			continue
+		}
+		if added[label] || !excludes(label, labelContains) {
+			recipe.DietaryLabels = append(recipe.DietaryLabels, label)
+		}
+	}
+	recipe.Allergens = pq.StringArray{}
+	for _, allergen := range allergens {
+		if contains[allergen] {
+			recipe.Allergens = append(recipe.Allergens, allergen)
+		}
+	}
+	recipe.DietaryVersion = rulesVersion
+}
+
+// Contents returns what the rule table says an ingredient contains. Where
+// rules overlap the longer one decides, so "peanut butter" is not dairy.
+func Contents(name string) []string {
+	type match struct {
+		start, end int
+		contains   []string
+	}
+	nameWords := words(name)
+	var matches []match
+	for _, r := range rules {
+		for start := 0; start+len(r.words) <= len(nameWords); start++ {
+			if matchesAt(nameWords, r.words, start) {
+				matches = append(matches, match{start, start + len(r.words), r.contains})
+			}
+		}
+	}
+
+	var contents []string
+	seen := make(map[string]bool)
+	for _, m := range matches {
+		covered := false
+		for _, other := range matches {
+			if other.end-other.start > m.end-m.start && other.start <= m.start && other.end >= m.end {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+		for _, c := range m.contains {
+			if !seen[c] {
+				seen[c] = true
+				contents = append(contents, c)
+			}
+		}
+	}
+	sort.Strings(contents)
+	return contents
+}
+
+// NormalizeLabels checks dietary labels sent by a client, e.g. as the
+// preferences of a user, and returns them in the usual order.
+func NormalizeLabels(labels []string) (pq.StringArray, error) {
+	wanted := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if label == "" {
+			continue
+		}
+		if _, ok := labelExcludes[label]; !ok {
+			return nil, pkg.ErrDietary
+		}
+		wanted[label] = true
+	}
+	normalized := pq.StringArray{}
+	for _, label := range Labels {
+		if wanted[label] {
+			normalized = append(normalized, label)
+		}
+	}
+	return normalized, nil
+}
+
+func excludes(label string, contains map[string]bool) bool {
+	for _, c := range labelExcludes[label] {
+		if contains[c] {
+			return true
+		}
+	}
+	return false
+}
+
+func knownContent(c string) bool {
+	switch c {
+	case ContainsMeat, ContainsHoney:
+		return true
+	}
+	for _, allergen := range allergens {
+		if allergen == c {
+			return true
+		}
+	}
+	return false
+}
+
+func compileRules(table map[string][]string) []rule {
+	compiled := make([]rule, 0, len(table))
+	for w, contains := range table {
+		if ruleWords := words(w); len(ruleWords) > 0 {
+			compiled = append(compiled, rule{words: ruleWords, contains: contains})
+		}
+	}
+	return compiled
+}
+
+// Goes up whenever Classify changes, so labels from before are recalculated
+const classifyVersion = 2
+
+func versionOf(table map[string][]string) string {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := fnv.New64a()
+	fmt.Fprintf(h, "v%d;", classifyVersion)
+	for _, key := range keys {
+		contains := append([]string(nil), table[key]...)
+		sort.Strings(contains)
+		fmt.Fprintf(h, "%s=%s;", key, strings.Join(contains, ","))
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,190 @@
+package nutrition
+
+// foodsCSV is the food composition table ingredients are matched against.
+// Nutrients are per 100 g of the food as bought (raw, dry or canned and
+// drained), rounded from USDA FoodData Central SR Legacy. Aliases are
+// separated by "|", density is in grams per millilitre and left at 0 for foods
+// not measured by volume, piece_grams is the weight of one piece, clove, slice
+// or stick.
+const foodsCSV = `name,aliases,calories,protein,fat,carbohydrates,fiber,density,piece_grams
+all-purpose flour,flour|plain flour|all purpose flour|maida|self-raising flour|self rising flour,364,10.3,1,76.3,2.7,0.53,0
+whole wheat flour,wholemeal flour|atta,340,13.2,2.5,72,10.7,0.51,0
+bread flour,strong flour,361,12,1.7,72.5,2.4,0.54,0
+rice flour,,366,6,1.4,80.1,2.4,0.67,0
+cornstarch,corn starch|cornflour|corn flour,381,0.3,0.1,91.3,0.9,0.54,0
+cornmeal,polenta,370,8.1,3.6,79.5,7.3,0.67,0
+white rice,rice|basmati rice|jasmine rice|long grain rice|arborio rice|sushi rice,365,7.1,0.7,80,1.3,0.85,0
+brown rice,,370,7.9,2.9,77.2,3.5,0.8,0
+rolled oats,oats|oatmeal|porridge oats|quick oats,379,13.2,6.5,67.7,10.1,0.38,0
+pasta,spaghetti|penne|macaroni|fusilli|linguine|fettuccine|lasagne|lasagna|noodles|egg noodles,371,13,1.5,74.7,3.2,0.4,0
+rice noodles,,364,6,0.6,80.2,1.6,0.4,0
+bread,white bread|sandwich bread|toast,266,8.9,3.3,49.4,2.7,0,30
+whole wheat bread,wholemeal bread|brown bread,252,12.5,3.5,42.7,6,0,32
+tortilla,tortillas|flour tortilla|wrap,306,8.2,8,50.4,3.5,0,45
+breadcrumbs,bread crumbs|panko,395,13.4,5.3,71.9,4.5,0.45,0
+quinoa,,368,14.1,6.1,64.2,7,0.72,0
+couscous,,376,12.8,0.6,77.4,5,0.73,0
+sugar,white sugar|granulated sugar|caster sugar|superfine sugar,387,0,0,100,0,0.85,0
+brown sugar,light brown sugar|dark brown sugar|jaggery,380,0.1,0,98.1,0,0.83,0
+powdered sugar,icing sugar|confectioners sugar|confectioners' sugar,389,0,0,99.8,0,0.5,0
+honey,,304,0.3,0,82.4,0.2,1.42,0
+maple syrup,,260,0,0.1,67,0,1.32,0
+golden syrup,corn syrup|light corn syrup,286,0,0,77.6,0,1.38,0
+molasses,treacle,290,0,0.1,74.7,0,1.4,0
+butter,unsalted butter|salted butter,717,0.9,81.1,0.1,0,0.91,113
+ghee,clarified butter,876,0.3,99.5,0,0,0.91,0
+vegetable oil,oil|canola oil|rapeseed oil|sunflower oil|cooking oil|neutral oil|peanut oil,884,0,100,0,0,0.92,0
+olive oil,extra virgin olive oil|extra-virgin olive oil,884,0,100,0,0,0.92,0
+coconut oil,,862,0,100,0,0,0.92,0
+sesame oil,toasted sesame oil,884,0,100,0,0,0.92,0
+margarine,,717,0.2,80.7,0.7,0,0.91,0
+whole milk,milk,61,3.2,3.3,4.8,0,1.03,0
+skim milk,skimmed milk|low fat milk|semi-skimmed milk,34,3.4,0.1,5,0,1.03,0
+buttermilk,,40,3.3,0.9,4.8,0,1.03,0
+evaporated milk,,134,6.8,7.6,10,0,1.07,0
+condensed milk,sweetened condensed milk,321,7.9,8.7,54.4,0,1.3,0
+heavy cream,cream|double cream|whipping cream|heavy whipping cream,340,2.8,36.1,2.7,0,1,0
+single cream,light cream|half and half|half-and-half,131,3,12.7,4.3,0,1.01,0
+sour cream,,198,2.4,19.4,4.6,0,0.97,0
+yogurt,yoghurt|plain yogurt|natural yogurt|curd|dahi,61,3.5,3.3,4.7,0,1.03,0
+greek yogurt,greek yoghurt|strained yogurt,97,9,5,3.9,0,1.05,0
+almond milk,,15,0.6,1.1,0.6,0.2,1,0
+soy milk,soya milk,54,3.3,1.8,6.3,0.6,1.02,0
+coconut milk,,230,2.3,23.8,5.5,2.2,0.97,0
+coconut cream,,330,3.6,34.7,6.7,2.2,1,0
+cheddar,cheddar cheese|cheese|grated cheese|shredded cheese,403,24.9,33.1,1.3,0,0.45,28
+mozzarella,mozzarella cheese,280,27.5,17.1,3.1,0,0.45,28
+parmesan,parmesan cheese|parmigiano reggiano|parmigiano|grana padano,431,38.5,28.6,4.1,0,0.4,0
+cream cheese,,342,5.9,34.2,4.1,0,0.95,0
+feta,feta cheese,264,14.2,21.3,4.1,0,0.6,0
+ricotta,ricotta cheese,174,11.3,13,3,0,1.02,0
+cottage cheese,,98,11.1,4.3,3.4,0,0.95,0
+paneer,,321,25,25,3.6,0,0.6,0
+egg,eggs|large egg|whole egg,143,12.6,9.5,0.7,0,1.03,50
+egg white,egg whites,52,10.9,0.2,0.7,0,1.03,33
+egg yolk,egg yolks,322,15.9,26.5,3.6,0,1.03,17
+chicken breast,chicken breasts|chicken fillet|chicken,120,22.5,2.6,0,0,0,170
+chicken thigh,chicken thighs|boneless chicken thigh,121,19.7,4.1,0,0,0,110
+ground chicken,minced chicken|chicken mince,143,17.4,8.1,0,0,0,0
+ground beef,minced beef|beef mince|mince|beef,254,17.2,20,0,0,0,0
+beef steak,steak|sirloin|beef sirloin|stewing beef|beef chuck,158,21,7.6,0,0,0,225
+ground pork,minced pork|pork mince,263,16.9,21.2,0,0,0,0
+pork,pork loin|pork chop|pork chops|pork shoulder,143,21.2,5.9,0,0,0,170
+bacon,streaky bacon,417,12.6,39.7,1.4,0,0,23
+ham,,145,21,5.5,1.5,0,0,28
+sausage,sausages|pork sausage,301,12,27,2,0,0,75
+lamb,lamb shoulder|leg of lamb|ground lamb|minced lamb,282,16.6,23.4,0,0,0,0
+turkey,turkey breast|ground turkey,114,23.7,1.5,0.1,0,0,0
+salmon,salmon fillet|salmon fillets,208,20.4,13.4,0,0,0,170
+white fish,cod|haddock|tilapia|pollock|hake,82,17.8,0.7,0,0,0,170
+tuna,canned tuna|tinned tuna,116,25.5,0.8,0,0,0,0
+shrimp,prawns|prawn|shrimps,85,20.1,0.5,0,0,0,12
+tofu,firm tofu|silken tofu|bean curd,76,8.1,4.8,1.9,0.3,0,0
+chickpeas,garbanzo beans|garbanzos|chole|chana,139,7,2.8,22.5,6,0.66,0
+black beans,,91,6,0.3,16.6,6.9,0.7,0
+kidney beans,red kidney beans|rajma,84,5.2,0.4,15,6.2,0.7,0
+cannellini beans,white beans|navy beans|haricot beans|butter beans|lima beans,114,7.3,0.3,20.6,6.6,0.7,0
+lentils,lentil|red lentils|green lentils|brown lentils|dal|dhal|masoor dal|toor dal|moong dal,352,24.6,1.1,63.4,10.7,0.8,0
+peanut butter,,588,25.1,50.4,20,6,1.09,0
+almonds,almond|flaked almonds|sliced almonds|slivered almonds,579,21.2,49.9,21.6,12.5,0.6,1.2
+ground almonds,almond flour|almond meal,571,21.4,50,21.4,10.7,0.4,0
+walnuts,walnut,654,15.2,65.2,13.7,6.7,0.42,4
+peanuts,peanut,567,25.8,49.2,16.1,8.5,0.6,0
+cashews,cashew|cashew nuts,553,18.2,43.9,30.2,3.3,0.58,1.5
+pine nuts,pine nut,673,13.7,68.4,13.1,3.7,0.57,0
+pecans,pecan,691,9.2,72,13.9,9.6,0.45,0
+sesame seeds,sesame,573,17.7,49.7,23.5,11.8,0.6,0
+chia seeds,chia,486,16.5,30.7,42.1,34.4,0.65,0
+sunflower seeds,,584,20.8,51.5,20,8.6,0.58,0
+desiccated coconut,shredded coconut|coconut flakes|grated coconut|coconut,660,6.9,64.5,23.7,16.3,0.35,0
+onion,onions|red onion|white onion|yellow onion|brown onion,40,1.1,0.1,9.3,1.7,0.68,110
+shallot,shallots,72,2.5,0.1,16.8,3.2,0.68,30
+spring onion,spring onions|green onion|green onions|scallion|scallions,32,1.8,0.2,7.3,2.6,0.42,15
+leek,leeks,61,1.5,0.3,14.2,1.8,0.37,90
+garlic,garlic clove|garlic cloves,149,6.4,0.5,33.1,2.1,0.57,3
+garlic powder,,331,16.6,0.7,72.7,9,0.5,0
+onion powder,,341,10.4,1,79.1,15.2,0.5,0
+ginger,fresh ginger|ginger root,80,1.8,0.8,17.8,2,0.4,0
+ground ginger,ginger powder,335,9,4.2,71.6,14.1,0.38,0
+tomato,tomatoes|cherry tomatoes|plum tomatoes|roma tomatoes,18,0.9,0.2,3.9,1.2,0.76,123
+canned tomatoes,chopped tomatoes|crushed tomatoes|tinned tomatoes|diced tomatoes|passata|tomato sauce,32,1.6,0.3,7.3,1.9,1.03,0
+tomato paste,tomato puree,82,4.3,0.5,18.9,4.1,1.1,0
+potato,potatoes|russet potatoes|new potatoes,77,2,0.1,17.5,2.1,0.64,213
+sweet potato,sweet potatoes|yam,86,1.6,0.1,20.1,3,0.56,130
+carrot,carrots,41,0.9,0.2,9.6,2.8,0.54,61
+celery,celery stalk|celery stalks|celery sticks,16,0.7,0.2,3,1.6,0.43,40
+bell pepper,bell peppers|capsicum|red pepper|green pepper|yellow pepper|red bell pepper,31,1,0.3,6,2.1,0.63,120
+chili pepper,chili|chilli|chillies|chilies|green chili|green chilli|red chilli|jalapeno|jalapeño,40,1.9,0.4,8.8,1.5,0.6,15
+chili powder,chilli powder|cayenne|cayenne pepper|red chili powder|chili flakes|chilli flakes|red pepper flakes,282,13.5,14.3,49.7,34.8,0.5,0
+broccoli,,34,2.8,0.4,6.6,2.6,0.38,0
+cauliflower,,25,1.9,0.3,5,2,0.45,0
+spinach,baby spinach|palak,23,2.9,0.4,3.6,2.2,0.13,0
+kale,,49,4.3,0.9,8.8,3.6,0.28,0
+lettuce,romaine|romaine lettuce|iceberg lettuce|salad leaves|mixed greens,15,1.4,0.2,2.9,1.3,0.2,0
+cabbage,red cabbage|white cabbage,25,1.3,0.1,5.8,2.5,0.38,0
+cucumber,cucumbers,15,0.7,0.1,3.6,0.5,0.56,300
+zucchini,courgette|courgettes,17,1.2,0.3,3.1,1,0.53,200
+eggplant,aubergine|aubergines|brinjal,25,1,0.2,5.9,3,0.35,450
+mushrooms,mushroom|button mushrooms|cremini mushrooms|chestnut mushrooms,22,3.1,0.3,3.3,1,0.3,18
+peas,green peas|frozen peas|petits pois,81,5.4,0.4,14.5,5.1,0.62,0
+sweetcorn,corn|sweet corn|corn kernels,86,3.3,1.4,19,2.7,0.65,0
+green beans,french beans|string beans,31,1.8,0.2,7,2.7,0.46,0
+asparagus,,20,2.2,0.1,3.9,2.1,0.57,16
+pumpkin,butternut squash|squash,26,1,0.1,6.5,0.5,0.49,0
+beetroot,beets|beet,43,1.6,0.2,9.6,2.8,0.57,82
+avocado,avocados,160,2,14.7,8.5,6.7,0.62,150
+lemon,lemons,29,1.1,0.3,9.3,2.8,0,84
+lemon juice,,22,0.4,0.2,6.9,0.3,1.03,0
+lemon zest,lemon peel,47,1.5,0.3,16,10.6,0.4,0
+lime,limes,30,0.7,0.2,10.5,2.8,0,67
+lime juice,,25,0.4,0.1,8.4,0.4,1.03,0
+orange,oranges,47,0.9,0.1,11.8,2.4,0,131
+orange juice,,45,0.7,0.2,10.4,0.2,1.04,0
+apple,apples,52,0.3,0.2,13.8,2.4,0.53,182
+banana,bananas,89,1.1,0.3,22.8,2.6,0.63,118
+strawberries,strawberry,32,0.7,0.3,7.7,2,0.7,12
+blueberries,blueberry,57,0.7,0.3,14.5,2.4,0.63,0
+raspberries,raspberry,52,1.2,0.7,11.9,6.5,0.52,0
+mango,mangoes,60,0.8,0.4,15,1.6,0.7,200
+pineapple,,50,0.5,0.1,13.1,1.4,0.7,0
+raisins,sultanas|currants,299,3.1,0.5,79.2,3.7,0.61,0
+dates,date|medjool dates,282,2.5,0.4,75,8,0.62,8
+dark chocolate,chocolate|chocolate chips|semisweet chocolate|bittersweet chocolate,546,4.9,31.3,61.2,7,0.72,0
+cocoa powder,cocoa|unsweetened cocoa,228,19.6,13.7,57.9,37,0.36,0
+baking powder,,53,0,0,27.7,0.2,0.93,0
+baking soda,bicarbonate of soda|bicarb soda|bicarbonate,0,0,0,0,0,0.93,0
+yeast,dry yeast|instant yeast|active dry yeast,325,40.4,7.6,41.2,26.9,0.68,0
+gelatin,gelatine,335,85.6,0.1,0,0,0.6,0
+salt,sea salt|kosher salt|table salt,0,0,0,0,0,1.22,0
+black pepper,pepper|ground pepper|ground black pepper|peppercorns,251,10.4,3.3,64,25.3,0.47,0
+cumin,cumin seeds|ground cumin|jeera,375,17.8,22.3,44.2,10.5,0.43,0
+coriander seeds,ground coriander|coriander powder|dhania powder,298,12.4,17.8,55,41.9,0.4,0
+paprika,smoked paprika|sweet paprika,282,14.1,12.9,54,34.9,0.46,0
+turmeric,ground turmeric|haldi,312,9.7,3.3,67.1,22.7,0.61,0
+cinnamon,ground cinnamon|cinnamon stick|cinnamon sticks,247,4,1.2,80.6,53.1,0.53,2.6
+garam masala,curry powder|mixed spice,325,14.3,14,58.2,33.2,0.45,0
+dried herbs,oregano|dried oregano|thyme|dried thyme|mixed herbs|italian seasoning|rosemary|dried rosemary|bay leaf|bay leaves,265,9,4.3,68.9,42.5,0.2,0.2
+nutmeg,ground nutmeg,525,5.8,36.3,49.3,20.8,0.47,0
+vanilla extract,vanilla|vanilla essence,288,0.1,0.1,12.7,0,0.88,0
+parsley,fresh parsley|flat leaf parsley,36,3,0.8,6.3,3.3,0.25,0
+coriander,cilantro|coriander leaves|fresh coriander,23,2.1,0.5,3.7,2.8,0.07,0
+basil,fresh basil|basil leaves,23,3.2,0.6,2.7,1.6,0.09,0
+mint,mint leaves|fresh mint,44,3.3,0.7,8.4,6.8,0.2,0
+dill,fresh dill,43,3.5,1.1,7,2.1,0.2,0
+soy sauce,soya sauce|light soy sauce|dark soy sauce|tamari,53,8.1,0.6,4.9,0.8,1.08,0
+fish sauce,,35,5.1,0,3.6,0,1.2,0
+oyster sauce,,51,1.4,0.3,10.9,0.3,1.2,0
+vinegar,white vinegar|rice vinegar|wine vinegar|red wine vinegar|white wine vinegar|apple cider vinegar|cider vinegar,18,0,0,0.9,0,1.01,0
+balsamic vinegar,,88,0.5,0,17,0,1.06,0
+mayonnaise,mayo,680,1,74.9,0.6,0,0.93,0
+ketchup,tomato ketchup,101,1,0.1,27.4,0.3,1.15,0
+mustard,dijon mustard|yellow mustard|wholegrain mustard,60,3.7,3.3,5.8,4,1.01,0
+worcestershire sauce,,78,0,0,19.5,0,1.1,0
+hot sauce,sriracha|tabasco,11,0.5,0.4,1.8,0.3,1.05,0
+tahini,,595,17,53.8,21.2,9.3,0.95,0
+stock,broth|chicken stock|chicken broth|vegetable stock|vegetable broth|beef stock|beef broth,6,0.6,0.2,0.4,0,1,0
+water,,0,0,0,0,0,1,0
+white wine,wine|dry white wine,82,0.1,0,2.6,0,0.99,0
+red wine,,85,0.1,0,2.6,0,0.99,0
+beer,,43,0.5,0,3.6,0,1.01,0
+`
@@ -0,0 +1,221 @@
+package nutrition
+
+import (
+	"encoding/csv"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Version is stored with every estimate and goes up whenever the food table or
+// the matching changes, so older estimates get recalculated.
+const Version = 1
+
+// Weights of the units that depend on neither the food nor the cook
+const (
+	canGrams     = 400
+	bunchGrams   = 40
+	handfulGrams = 30
+)
+
+// Food is one row of the food table, with nutrients per 100 g
+type Food struct {
+	Name       string
+	Per100g    entities.Nutrition
+	Density    float64
+	PieceGrams float64
+
+	aliases [][]string
+}
+
+var foods = loadFoods(foodsCSV)
+
+func loadFoods(table string) []Food {
+	rows, err := csv.NewReader(strings.NewReader(table)).ReadAll()
+	if err != nil {
+		panic("nutrition: reading food table: " + err.Error())
+	}
+	var loaded []Food
+	for _, row := range rows[1:] {
+		var values [7]float64
+		for i := range values {
+			values[i], err = strconv.ParseFloat(row[i+2], 64)
+			if err != nil {
+				panic("nutrition: bad value for " + row[0] + ": " + err.Error())
+			}
+		}
+		food := Food{
+			Name: row[0],
+			Per100g: entities.Nutrition{
+				Calories:      values[0],
+				Protein:       values[1],
+				Fat:           values[2],
+				Carbohydrates: values[3],
+				Fiber:         values[4],
+			},
+			Density:    values[5],
+			PieceGrams: values[6],
+		}
+		names := []string{row[0]}
+		if row[1] != "" {
+			names = append(names, strings.Split(row[1], "|")...)
+		}
+		for _, name := range names {
+			food.aliases = append(food.aliases, words(name))
+		}
+		loaded = append(loaded, food)
+	}
+	return loaded
+}
+
+// Match finds the food an ingredient name refers to. The alias with the most
+// words wins, so "chicken stock" is stock and not chicken. Between aliases as
+// long, the one further right wins, as in "rice noodles".
+func Match(name string) (*Food, bool) {
+	nameWords := words(name)
+	var best *Food
+	bestLength, bestEnd := 0, 0
+	for i := range foods {
+		for _, alias := range foods[i].aliases {
+			end := lastIndex(nameWords, alias)
+			if end < 0 {
+				continue
+			}
+			if len(alias) > bestLength || (len(alias) == bestLength && end > bestEnd) {
+				best, bestLength, bestEnd = &foods[i], len(alias), end
+			}
+		}
+	}
+	return best, best != nil
+}
+
+// Calculate estimates the nutrition of the recipe from its ingredients and
+// stores it on the recipe.
+func Calculate(recipe *entities.Recipe) {
+	var total entities.Nutrition
+	measured, matched := 0, 0
+	for _, ingredient := range recipe.Ingredients {
+		if ingredient.Quantity == nil {
+			continue
+		}
+		measured++
+		food, ok := Match(ingredient.Name)
+		if !ok {
+			continue
+		}
+		g, ok := grams(*ingredient.Quantity, ingredient.Unit, food)
+		if !ok {
+			continue
+		}
+		matched++
+		total = add(total, food.Per100g, g/100)
+	}
+
+	recipe.Nutrition = round(total)
+	recipe.NutritionPerServing = entities.Nutrition{}
+	if recipe.Servings > 0 {
+		recipe.NutritionPerServing = round(add(entities.Nutrition{}, total, 1/float64(recipe.Servings)))
+	}
+	recipe.NutritionCoverage = 0
+	if measured > 0 {
+		recipe.NutritionCoverage = math.Round(float64(matched)/float64(measured)*100) / 100
+	}
+	recipe.NutritionVersion = Version
+}
+
+// Scale multiplies the nutrients, e.g. for a recipe made for more people.
+func Scale(n entities.Nutrition, factor float64) entities.Nutrition {
+	return round(add(entities.Nutrition{}, n, factor))
+}
+
+func grams(quantity float64, unit string, food *Food) (float64, bool) {
+	unit = strings.ToLower(unit)
+	if g, ok := GramsPer[unit]; ok {
+		return quantity * g, true
+	}
+	if ml, ok := MillilitresPer[unit]; ok {
+		if food.Density == 0 {
+			return 0, false
+		}
+		return quantity * ml * food.Density, true
+	}
+	switch unit {
+	case "can":
+		return quantity * canGrams, true
+	case "bunch":
+		return quantity * bunchGrams, true
+	case "handful":
+		return quantity * handfulGrams, true
+	case "", "piece", "clove", "slice", "stick":
+		if food.PieceGrams > 0 {
+			return quantity * food.PieceGrams, true
+		}
+	}
+	return 0, false
+}
+
+func add(sum, n entities.Nutrition, factor float64) entities.Nutrition {
+	sum.Calories += n.Calories * factor
+	sum.Protein += n.Protein * factor
+	sum.Fat += n.Fat * factor
+	sum.Carbohydrates += n.Carbohydrates * factor
+	sum.Fiber += n.Fiber * factor
+	return sum
+}
+
+// Estimates are rounded to whole kcal and tenths of a gram
+func round(n entities.Nutrition) entities.Nutrition {
+	return entities.Nutrition{
+		Calories:      math.Round(n.Calories),
+		Protein:       math.Round(n.Protein*10) / 10,
+		Fat:           math.Round(n.Fat*10) / 10,
+		Carbohydrates: math.Round(n.Carbohydrates*10) / 10,
+		Fiber:         math.Round(n.Fiber*10) / 10,
+	}
+}
+
+// words splits a name into lower case singular words, so "Cherry Tomatoes"
+// and "cherry tomato" compare equal.
+func words(name string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for i, field := range fields {
+		fields[i] = singular(field)
+	}
+	return fields
+}
+
+func singular(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "oes"), strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"):
+		return word[:len(word)-2]
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// lastIndex returns the index just past the last place the words of alias
+// appear in a row in name, or -1.
+func lastIndex(name, alias []string) int {
+	for start := len(name) - len(alias); start >= 0; start-- {
+		if matchesAt(name, alias, start) {
+			return start + len(alias)
+		}
+	}
+	return -1
+}
+
+func matchesAt(name, alias []string, start int) bool {
+	for i := range alias {
+		if name[start+i] != alias[i] {
+			return false
+		}
+	}
+	return true
+}
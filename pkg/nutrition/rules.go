@@ -0,0 +1,91 @@
+package nutrition
+
+// defaultRules maps words in ingredient names to what the ingredient contains.
+// Matching ignores case and plurals. Longer rules win where they overlap, which
+// is how the entries with nothing in them keep e.g. "coconut milk" from being
+// dairy. Extra rules can be loaded with LoadDietaryRules.
+var defaultRules = map[string][]string{
+	// Meat
+	"meat": {ContainsMeat}, "chicken": {ContainsMeat}, "beef": {ContainsMeat},
+	"pork": {ContainsMeat}, "lamb": {ContainsMeat}, "mutton": {ContainsMeat},
+	"goat": {ContainsMeat}, "veal": {ContainsMeat}, "duck": {ContainsMeat},
+	"turkey": {ContainsMeat}, "bacon": {ContainsMeat}, "ham": {ContainsMeat},
+	"sausage": {ContainsMeat}, "chorizo": {ContainsMeat}, "salami": {ContainsMeat},
+	"pepperoni": {ContainsMeat}, "prosciutto": {ContainsMeat}, "pancetta": {ContainsMeat},
+	"mince": {ContainsMeat}, "steak": {ContainsMeat}, "lard": {ContainsMeat},
+	"suet": {ContainsMeat}, "gelatin": {ContainsMeat}, "gelatine": {ContainsMeat},
+	"vegetable stock": {}, "vegetable broth": {}, "goat cheese": {ContainsDairy},
+	"goat milk": {ContainsDairy}, "plant based meat": {}, "vegan sausage": {},
+
+	// Fish and shellfish
+	"fish": {ContainsFish}, "salmon": {ContainsFish}, "tuna": {ContainsFish},
+	"cod": {ContainsFish}, "haddock": {ContainsFish}, "hake": {ContainsFish},
+	"pollock": {ContainsFish}, "tilapia": {ContainsFish}, "trout": {ContainsFish},
+	"mackerel": {ContainsFish}, "sardine": {ContainsFish}, "anchovy": {ContainsFish},
+	"halibut": {ContainsFish}, "sea bass": {ContainsFish}, "worcestershire sauce": {ContainsFish},
+	"shrimp": {ContainsShellfish}, "prawn": {ContainsShellfish}, "crab": {ContainsShellfish},
+	"lobster": {ContainsShellfish}, "mussel": {ContainsShellfish}, "clam": {ContainsShellfish},
+	"oyster": {ContainsShellfish}, "scallop": {ContainsShellfish}, "squid": {ContainsShellfish},
+	"calamari": {ContainsShellfish}, "oyster sauce": {ContainsShellfish},
+	"oyster mushroom": {}, "vegan fish sauce": {},
+
+	// Dairy
+	"milk": {ContainsDairy}, "butter": {ContainsDairy}, "buttermilk": {ContainsDairy},
+	"cream": {ContainsDairy}, "cheese": {ContainsDairy}, "cheddar": {ContainsDairy},
+	"mozzarella": {ContainsDairy}, "parmesan": {ContainsDairy}, "parmigiano": {ContainsDairy},
+	"feta": {ContainsDairy}, "ricotta": {ContainsDairy}, "mascarpone": {ContainsDairy},
+	"paneer": {ContainsDairy}, "ghee": {ContainsDairy}, "yogurt": {ContainsDairy},
+	"yoghurt": {ContainsDairy}, "curd": {ContainsDairy}, "dahi": {ContainsDairy},
+	"whey": {ContainsDairy}, "casein": {ContainsDairy}, "white chocolate": {ContainsDairy},
+	"coconut milk": {}, "coconut cream": {}, "coconut yogurt": {}, "oat milk": {},
+	"rice milk": {}, "plant milk": {}, "cream of tartar": {}, "cocoa butter": {},
+	"butter bean": {}, "vegan butter": {}, "vegan cheese": {}, "dairy free milk": {},
+	"almond milk": {ContainsTreeNuts}, "cashew milk": {ContainsTreeNuts},
+	"almond butter": {ContainsTreeNuts}, "cashew butter": {ContainsTreeNuts},
+	"peanut butter": {ContainsPeanuts}, "soy milk": {ContainsSoy}, "soya milk": {ContainsSoy},
+	"soy yogurt": {ContainsSoy},
+
+	// Eggs
+	"egg": {ContainsEgg}, "mayonnaise": {ContainsEgg}, "mayo": {ContainsEgg},
+	"meringue": {ContainsEgg}, "aioli": {ContainsEgg},
+	"egg noodle": {ContainsEgg, ContainsGluten}, "vegan mayo": {}, "vegan mayonnaise": {},
+	"egg replacer": {}, "flax egg": {},
+
+	// Gluten
+	"flour": {ContainsGluten}, "wheat": {ContainsGluten}, "bread": {ContainsGluten},
+	"breadcrumb": {ContainsGluten}, "panko": {ContainsGluten}, "pasta": {ContainsGluten},
+	"spaghetti": {ContainsGluten}, "penne": {ContainsGluten}, "macaroni": {ContainsGluten},
+	"fusilli": {ContainsGluten}, "linguine": {ContainsGluten}, "fettuccine": {ContainsGluten},
+	"lasagna": {ContainsGluten}, "lasagne": {ContainsGluten}, "noodle": {ContainsGluten},
+	"couscous": {ContainsGluten}, "bulgur": {ContainsGluten}, "barley": {ContainsGluten},
+	"rye": {ContainsGluten}, "spelt": {ContainsGluten}, "semolina": {ContainsGluten},
+	"seitan": {ContainsGluten}, "maida": {ContainsGluten}, "atta": {ContainsGluten},
+	"tortilla": {ContainsGluten}, "pastry": {ContainsGluten}, "filo": {ContainsGluten},
+	"phyllo": {ContainsGluten}, "cracker": {ContainsGluten}, "biscuit": {ContainsGluten},
+	"malt": {ContainsGluten}, "beer": {ContainsGluten}, "oat": {ContainsGluten},
+	"oatmeal": {ContainsGluten}, "ramen": {ContainsGluten}, "udon": {ContainsGluten}, "soba": {ContainsGluten},
+	"gluten free flour": {}, "gluten free pasta": {}, "gluten free bread": {},
+	"gluten free oat": {}, "gluten free noodle": {}, "gluten free breadcrumb": {},
+	"gluten free soy sauce": {ContainsSoy}, "rice flour": {}, "coconut flour": {},
+	"chickpea flour": {}, "gram flour": {}, "besan": {}, "buckwheat flour": {},
+	"potato flour": {}, "tapioca flour": {}, "corn flour": {}, "corn tortilla": {},
+	"rice noodle": {}, "rice paper": {}, "almond flour": {ContainsTreeNuts},
+	"soy sauce": {ContainsSoy, ContainsGluten},
+
+	// Nuts
+	"nut": {ContainsTreeNuts}, "almond": {ContainsTreeNuts}, "walnut": {ContainsTreeNuts},
+	"cashew": {ContainsTreeNuts}, "pecan": {ContainsTreeNuts}, "pistachio": {ContainsTreeNuts},
+	"hazelnut": {ContainsTreeNuts}, "macadamia": {ContainsTreeNuts}, "pine nut": {ContainsTreeNuts},
+	"brazil nut": {ContainsTreeNuts}, "praline": {ContainsTreeNuts}, "marzipan": {ContainsTreeNuts},
+	"nutella": {ContainsTreeNuts, ContainsDairy}, "peanut": {ContainsPeanuts},
+	"groundnut": {ContainsPeanuts}, "satay": {ContainsPeanuts},
+
+	// Soy and sesame
+	"soy": {ContainsSoy}, "soya": {ContainsSoy}, "tofu": {ContainsSoy},
+	"tempeh": {ContainsSoy}, "edamame": {ContainsSoy}, "miso": {ContainsSoy},
+	"tamari": {ContainsSoy},
+	"sesame": {ContainsSesame}, "tahini": {ContainsSesame}, "hummus": {ContainsSesame},
+
+	// Honey
+	"honey": {ContainsHoney},
+}
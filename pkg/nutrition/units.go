@@ -0,0 +1,24 @@
+package nutrition
+
+// Grams or millilitres in one of each unit, the one table recipes are both
+// converted and weighed with
+var (
+	GramsPer = map[string]float64{
+		"mg": 0.001,
+		"g":  1,
+		"kg": 1000,
+		"oz": 28.349523125,
+		"lb": 453.59237,
+	}
+	MillilitresPer = map[string]float64{
+		"ml":    1,
+		"l":     1000,
+		"tsp":   4.92892159375,
+		"tbsp":  14.78676478125,
+		"cup":   236.5882365,
+		"pt":    473.176473,
+		"qt":    946.352946,
+		"pinch": 0.308,
+		"dash":  0.616,
+	}
+)
@@ -0,0 +1,331 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long to wait before fetching the keys of a provider again when a token
+// names a key we do not know
+const keyRefreshInterval = time.Minute
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Provider is an OpenID Connect provider users can sign in with. Its endpoints
+// are discovered from the issuer on first use.
+type Provider struct {
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+
+	mu        sync.Mutex
+	metadata  *metadata
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// ProvidersFromEnv reads the providers from the oidcProviders env variable, a
+// JSON object keyed by provider name, e.g.
+// {"google": {"issuer": "https://accounts.google.com", "client_id": "...", "client_secret": "..."}}
+func ProvidersFromEnv() (map[string]*Provider, error) {
+	providers := map[string]*Provider{}
+	raw := os.Getenv("oidcProviders")
+	if raw == "" {
+		return providers, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &providers); err != nil {
+		return nil, err
+	}
+	for name, p := range providers {
+		if p.Issuer == "" || p.ClientID == "" {
+			return nil, fmt.Errorf("oidc: provider %s needs an issuer and a client_id", name)
+		}
+		p.Issuer = strings.TrimSuffix(p.Issuer, "/")
+		if p.RedirectURL == "" {
+			p.RedirectURL = os.Getenv("appUrl") + "/oidc/callback"
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{"openid", "email", "profile"}
+		}
+	}
+	return providers, nil
+}
+
+func (p *Provider) discover() (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var m metadata
+	if err := getJSON(p.Issuer+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(m.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("oidc: discovery returned issuer %s for %s", m.Issuer, p.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("oidc: incomplete discovery document from " + p.Issuer)
+	}
+	p.metadata = &m
+	return p.metadata, nil
+}
+
+func (p *Provider) authCodeURL(state, nonce, codeChallenge string) (string, error) {
+	m, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return m.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// exchange redeems an authorization code and returns the raw ID token.
+func (p *Provider) exchange(code, codeVerifier string) (string, error) {
+	m, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	response, err := httpClient.PostForm(m.TokenEndpoint, form)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var body struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK || body.IDToken == "" {
+		return "", fmt.Errorf("oidc: token endpoint answered %d %s", response.StatusCode, body.Error)
+	}
+	return body.IDToken, nil
+}
+
+// verify checks the signature and the claims of an ID token issued to us for
+// the login identified by nonce.
+func (p *Provider) verify(idToken, nonce string) (jwt.MapClaims, error) {
+	m, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, errors.New("oidc: unexpected signing method " + token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.key(m, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("oidc: invalid ID token")
+	}
+
+	if iss, _ := claims["iss"].(string); iss != m.Issuer {
+		return nil, errors.New("oidc: ID token from wrong issuer " + iss)
+	}
+	audiences := stringList(claims["aud"])
+	if !contains(audiences, p.ClientID) {
+		return nil, errors.New("oidc: ID token issued to another client")
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.ClientID {
+		return nil, errors.New("oidc: ID token issued to another client")
+	}
+	if _, ok := claims["exp"].(float64); !ok {
+		return nil, errors.New("oidc: ID token has no expiry")
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, errors.New("oidc: ID token nonce mismatch")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("oidc: ID token has no subject")
+	}
+	return claims, nil
+}
+
+// key returns the public key kid of the provider, fetching the key set again
+// when the provider rotated its keys.
+func (p *Provider) key(m *metadata, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.lookup(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.fetchedAt) < keyRefreshInterval {
+		return nil, errors.New("oidc: unknown key " + kid)
+	}
+
+	keys, err := fetchKeys(m.JWKSURI)
+	p.fetchedAt = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	if key := p.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, errors.New("oidc: unknown key " + kid)
+}
+
+// A token without kid is only accepted when there is no doubt which key it
+// means.
+func (p *Provider) lookup(kid string) interface{} {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+func fetchKeys(uri string) (map[string]interface{}, error) {
+	var set struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			Curve   string `json:"crv"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(uri, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.KeyType {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.KeyID] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Curve {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.KeyID] = &ecdsa.PublicKey{
+				Curve: curve,
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+	return keys, nil
+}
+
+func getJSON(uri string, v interface{}) error {
+	response, err := httpClient.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s answered %d", uri, response.StatusCode)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+// The aud claim may be a single string or a list of them
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
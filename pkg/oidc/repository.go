@@ -0,0 +1,62 @@
+package oidc
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"time"
+)
+
+type Repository interface {
+	CreateLoginState(state *entities.LoginState) error
+
+	ConsumeLoginState(state string, now time.Time) (*entities.LoginState, error)
+
+	DeleteExpiredLoginStates(now time.Time) error
+}
+
+type repo struct {
+	DB *gorm.DB
+}
+
+func NewRepo(db *gorm.DB) Repository {
+	return &repo{
+		DB: db,
+	}
+}
+
+func (r *repo) CreateLoginState(state *entities.LoginState) error {
+	if err := r.DB.Create(state).Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+// ConsumeLoginState deletes the login state and returns it. Each state can
+// only be consumed once, so a replayed callback finds nothing.
+func (r *repo) ConsumeLoginState(state string, now time.Time) (*entities.LoginState, error) {
+	loginState := &entities.LoginState{}
+	result := r.DB.Where("state = ? and expires_at > ?", state, now).First(loginState)
+	if result.RecordNotFound() {
+		return nil, pkg.ErrNotFound
+	}
+	if result.Error != nil {
+		return nil, pkg.ErrDatabase
+	}
+	result = r.DB.Where("id = ?", loginState.ID).Unscoped().Delete(&entities.LoginState{})
+	if result.Error != nil {
+		return nil, pkg.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return nil, pkg.ErrNotFound
+	}
+	return loginState, nil
+}
+
+func (r *repo) DeleteExpiredLoginStates(now time.Time) error {
+	err := r.DB.Where("expires_at <= ?", now).Unscoped().Delete(&entities.LoginState{}).Error
+	if err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
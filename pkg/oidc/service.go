@@ -0,0 +1,158 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"log"
+	"sort"
+	"time"
+)
+
+const loginStateTTL = 10 * time.Minute
+
+// Identity is what a provider told us about the user who signed in.
+type Identity struct {
+	Provider          string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type Service interface {
+	Providers() []string
+
+	AuthorizationURL(provider string) (string, error)
+
+	Exchange(state, code string) (*Identity, error)
+
+	DeleteExpiredLoginStates() error
+
+	GetRepo() Repository
+}
+
+type service struct {
+	repo      Repository
+	providers map[string]*Provider
+}
+
+func NewService(r Repository, providers map[string]*Provider) Service {
+	return &service{
+		repo:      r,
+		providers: providers,
+	}
+}
+
+func (s *service) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AuthorizationURL starts an authorization code flow with PKCE and returns the
+// URL of the provider's login page.
+func (s *service) AuthorizationURL(provider string) (string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", pkg.ErrProvider
+	}
+	state, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repo.CreateLoginState(&entities.LoginState{
+		State:        state,
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(loginStateTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := p.authCodeURL(state, nonce, codeChallenge(verifier))
+	if err != nil {
+		log.Printf("oidc: %s: %s", provider, err.Error())
+		return "", pkg.ErrProviderAuth
+	}
+	return authURL, nil
+}
+
+// Exchange finishes the flow started with AuthorizationURL and returns the
+// identity the provider vouches for.
+func (s *service) Exchange(state, code string) (*Identity, error) {
+	loginState, err := s.repo.ConsumeLoginState(state, time.Now())
+	if err == pkg.ErrNotFound {
+		return nil, pkg.ErrLoginState
+	}
+	if err != nil {
+		return nil, err
+	}
+	p, ok := s.providers[loginState.Provider]
+	if !ok {
+		return nil, pkg.ErrProvider
+	}
+
+	idToken, err := p.exchange(code, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("oidc: %s: %s", loginState.Provider, err.Error())
+		return nil, pkg.ErrProviderAuth
+	}
+	claims, err := p.verify(idToken, loginState.Nonce)
+	if err != nil {
+		log.Printf("oidc: %s: %s", loginState.Provider, err.Error())
+		return nil, pkg.ErrProviderAuth
+	}
+
+	identity := &Identity{Provider: loginState.Provider}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	identity.PreferredUsername, _ = claims["preferred_username"].(string)
+	// Some providers send email_verified as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	return identity, nil
+}
+
+func (s *service) DeleteExpiredLoginStates() error {
+	return s.repo.DeleteExpiredLoginStates(time.Now())
+}
+
+func (s *service) GetRepo() Repository {
+	return s.repo
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,47 @@
+package recipe
+
+import (
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+)
+
+// Orders recipe lists can be sorted in
+const (
+	SortLatest   = "latest"
+	SortQuickest = "quickest"
+)
+
+// Filter narrows down a list of recipes. Recipes have to match Query when it
+// is set, carry every one of Tags and Labels and be ready within MaxTotalTime
+// when it is set, which leaves out recipes without times.
+type Filter struct {
+	Query        string
+	Tags         []entities.Tag
+	Labels       []string
+	MaxTotalTime entities.Duration
+	Sort         string
+}
+
+func (f *Filter) validate() error {
+	if f.MaxTotalTime < 0 {
+		return pkg.ErrDuration
+	}
+	switch f.Sort {
+	case "":
+		f.Sort = SortLatest
+	case SortLatest, SortQuickest:
+	default:
+		return pkg.ErrSort
+	}
+	return nil
+}
+
+// orderBy sorts the quickest recipes first, then the ones without times.
+// Filtered lists only hold published recipes, so the latest are the ones
+// published last.
+func (f *Filter) orderBy() []string {
+	if f.Sort == SortQuickest {
+		return []string{"total_time = 0 asc", "total_time asc", "published_at desc"}
+	}
+	return []string{"published_at desc"}
+}
@@ -0,0 +1,62 @@
+package recipe
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+)
+
+// fork copies original into the account of user. The copy shares the image
+// files of the original, which are only deleted once no recipe uses them.
+// The copy starts as a draft, the user publishes it once it is their own.
+func fork(original *entities.Recipe, user *entities.User) *entities.Recipe {
+	forkedFromID := original.ID
+	recipe := &entities.Recipe{
+		UserID:              user.ID,
+		Visibility:          entities.VisibilityDraft,
+		RecipeName:          original.RecipeName,
+		Description:         original.Description,
+		Difficulty:          original.Difficulty,
+		Servings:            original.Servings,
+		PrepTime:            original.PrepTime,
+		CookTime:            original.CookTime,
+		RestTime:            original.RestTime,
+		TotalTime:           original.TotalTime,
+		ImgUrl:              original.ImgUrl,
+		ImgPublicId:         original.ImgPublicId,
+		ImgVariants:         original.ImgVariants,
+		Name:                user.Name,
+		Username:            user.Username,
+		UserImg:             user.ProfileImgUrl,
+		ForkedFromID:        &forkedFromID,
+		ForkedFromUsername:  original.Username,
+		Nutrition:           original.Nutrition,
+		NutritionPerServing: original.NutritionPerServing,
+		NutritionCoverage:   original.NutritionCoverage,
+		NutritionVersion:    original.NutritionVersion,
+		DietaryLabels:       append(pq.StringArray{}, original.DietaryLabels...),
+		Allergens:           append(pq.StringArray{}, original.Allergens...),
+		AddedLabels:         append(pq.StringArray{}, original.AddedLabels...),
+		RemovedLabels:       append(pq.StringArray{}, original.RemovedLabels...),
+		DietaryVersion:      original.DietaryVersion,
+	}
+	for _, ingredient := range original.Ingredients {
+		ingredient.Model = gorm.Model{}
+		ingredient.RecipeID = 0
+		recipe.Ingredients = append(recipe.Ingredients, ingredient)
+	}
+	for _, step := range original.Steps {
+		step.Model = gorm.Model{}
+		step.RecipeID = 0
+		recipe.Steps = append(recipe.Steps, step)
+	}
+	for _, tag := range original.Tags {
+		recipe.Tags = append(recipe.Tags, entities.Tag{Kind: tag.Kind, Slug: tag.Slug, Name: tag.Name})
+	}
+	for _, image := range original.Images {
+		image.Model = gorm.Model{}
+		image.RecipeID = 0
+		recipe.Images = append(recipe.Images, image)
+	}
+	return recipe
+}
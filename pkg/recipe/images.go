@@ -0,0 +1,51 @@
+package recipe
+
+import (
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"strings"
+)
+
+const (
+	maxImages        = 20
+	maxAltTextLength = 250
+)
+
+// NormalizeAltText trims the alt text of an image and checks its length.
+func NormalizeAltText(text string) (string, error) {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) > maxAltTextLength {
+		return "", pkg.ErrImages
+	}
+	return text, nil
+}
+
+// normalizeImages numbers the images of a new recipe in the order they were
+// given and makes sure exactly one of them is the cover, the first one unless
+// another was picked. The cover is mirrored onto the recipe.
+func normalizeImages(recipe *entities.Recipe) error {
+	if len(recipe.Images) > maxImages {
+		return pkg.ErrImages
+	}
+	cover := 0
+	for i := len(recipe.Images) - 1; i >= 0; i-- {
+		if recipe.Images[i].Cover {
+			cover = i
+		}
+	}
+	for i := range recipe.Images {
+		text, err := NormalizeAltText(recipe.Images[i].AltText)
+		if err != nil {
+			return err
+		}
+		recipe.Images[i].AltText = text
+		recipe.Images[i].Position = i
+		recipe.Images[i].Cover = i == cover
+	}
+	if len(recipe.Images) > 0 {
+		recipe.ImgUrl = recipe.Images[cover].ImgUrl
+		recipe.ImgPublicId = recipe.Images[cover].ImgPublicId
+		recipe.ImgVariants = recipe.Images[cover].ImgVariants
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package recipe
+
+import (
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxIngredients = 100
+	// Large enough for any real recipe while scaling stays far from overflowing
+	maxQuantity = 100000
+)
+
+var unitAliases = map[string]string{
+	"g": "g", "gr": "g", "gram": "g", "grams": "g",
+	"kg": "kg", "kilogram": "kg", "kilograms": "kg",
+	"mg": "mg", "milligram": "mg", "milligrams": "mg",
+	"ml": "ml", "milliliter": "ml", "milliliters": "ml", "millilitre": "ml", "millilitres": "ml",
+	"l": "l", "liter": "l", "liters": "l", "litre": "l", "litres": "l",
+	"tsp": "tsp", "tsps": "tsp", "teaspoon": "tsp", "teaspoons": "tsp",
+	"tbsp": "tbsp", "tbsps": "tbsp", "tbs": "tbsp", "tablespoon": "tbsp", "tablespoons": "tbsp",
+	"cup": "cup", "cups": "cup",
+	"oz": "oz", "ounce": "oz", "ounces": "oz",
+	"lb": "lb", "lbs": "lb", "pound": "lb", "pounds": "lb",
+	"pt": "pt", "pint": "pt", "pints": "pt",
+	"qt": "qt", "quart": "qt", "quarts": "qt",
+	"pinch": "pinch", "pinches": "pinch",
+	"dash": "dash", "dashes": "dash",
+	"clove": "clove", "cloves": "clove",
+	"can": "can", "cans": "can",
+	"slice": "slice", "slices": "slice",
+	"piece": "piece", "pieces": "piece",
+	"bunch": "bunch", "bunches": "bunch",
+	"handful": "handful", "handfuls": "handful",
+	"stick": "stick", "sticks": "stick",
+}
+
+var vulgarFractions = map[rune]float64{
+	'½': 1.0 / 2, '⅓': 1.0 / 3, '⅔': 2.0 / 3, '¼': 1.0 / 4, '¾': 3.0 / 4,
+	'⅕': 1.0 / 5, '⅙': 1.0 / 6, '⅛': 1.0 / 8, '⅜': 3.0 / 8, '⅝': 5.0 / 8, '⅞': 7.0 / 8,
+}
+
+// NormalizeIngredients checks ingredients sent by a client and returns clean
+// copies numbered in the order they were given.
+func NormalizeIngredients(ingredients []entities.Ingredient) ([]entities.Ingredient, error) {
+	if len(ingredients) > maxIngredients {
+		return nil, pkg.ErrIngredients
+	}
+	normalized := make([]entities.Ingredient, 0, len(ingredients))
+	for i, ingredient := range ingredients {
+		name := strings.TrimSpace(ingredient.Name)
+		if name == "" || (ingredient.Quantity != nil && !validQuantity(*ingredient.Quantity)) {
+			return nil, pkg.ErrIngredients
+		}
+		unit := strings.TrimSpace(ingredient.Unit)
+		if canonical, ok := unitAliases[strings.ToLower(unit)]; ok {
+			unit = canonical
+		}
+		normalized = append(normalized, entities.Ingredient{
+			Position: i,
+			Name:     name,
+			Quantity: ingredient.Quantity,
+			Unit:     unit,
+			Note:     strings.TrimSpace(ingredient.Note),
+			Group:    strings.TrimSpace(ingredient.Group),
+		})
+	}
+	return normalized, nil
+}
+
+// ParseIngredients makes a best effort at reading a free text ingredient list,
+// one ingredient per line, e.g. "1 1/2 cups flour, sifted". A line ending in a
+// colon starts a group. Whatever cannot be read as quantity or unit stays in
+// the name, so nothing the author wrote gets lost.
+func ParseIngredients(text string) []entities.Ingredient {
+	var ingredients []entities.Ingredient
+	group := ""
+	for _, line := range ingredientLines(text) {
+		if strings.HasSuffix(line, ":") {
+			group = strings.TrimSpace(strings.TrimSuffix(line, ":"))
+			continue
+		}
+		ingredient := parseIngredientLine(line)
+		ingredient.Position = len(ingredients)
+		ingredient.Group = group
+		ingredients = append(ingredients, ingredient)
+	}
+	return ingredients
+}
+
+// RawIngredients keeps every line of a free text ingredient list as it was
+// written, as the name of an ingredient, for lists ParseIngredients reads
+// into something that is not valid.
+func RawIngredients(text string) []entities.Ingredient {
+	var ingredients []entities.Ingredient
+	for _, line := range ingredientLines(text) {
+		ingredients = append(ingredients, entities.Ingredient{Position: len(ingredients), Name: line})
+	}
+	return ingredients
+}
+
+func ingredientLines(text string) []string {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	// Short lists were often written on one line
+	if len(lines) == 1 {
+		lines = strings.Split(text, ",")
+	}
+	var trimmed []string
+	for _, line := range lines {
+		line = trimBullet(strings.TrimSpace(line))
+		if line != "" {
+			trimmed = append(trimmed, line)
+		}
+	}
+	return trimmed
+}
+
+func parseIngredientLine(line string) entities.Ingredient {
+	var ingredient entities.Ingredient
+	fields := strings.Fields(line)
+
+	// Up to two tokens of quantity, as in "1 1/2"
+	var quantity float64
+	found := false
+	for len(fields) > 0 {
+		n, unit, ok := parseQuantityToken(fields[0])
+		if !ok || (found && unit == "" && n >= 1) {
+			break
+		}
+		quantity += n
+		found = true
+		fields = fields[1:]
+		if unit != "" {
+			ingredient.Unit = unit
+			break
+		}
+	}
+	if found {
+		ingredient.Quantity = &quantity
+	}
+
+	if ingredient.Unit == "" && len(fields) > 1 {
+		if unit, ok := parseUnit(fields[0]); ok {
+			ingredient.Unit = unit
+			fields = fields[1:]
+		}
+	}
+	if len(fields) > 1 && strings.ToLower(fields[0]) == "of" {
+		fields = fields[1:]
+	}
+
+	name := strings.Join(fields, " ")
+	var notes []string
+	if open := strings.Index(name, "("); open >= 0 {
+		if end := strings.Index(name[open:], ")"); end > 0 {
+			notes = append(notes, strings.TrimSpace(name[open+1:open+end]))
+			name = strings.TrimSpace(name[:open] + name[open+end+1:])
+		}
+	}
+	if comma := strings.Index(name, ","); comma >= 0 {
+		notes = append(notes, strings.TrimSpace(name[comma+1:]))
+		name = strings.TrimSpace(name[:comma])
+	}
+	if strings.HasSuffix(strings.ToLower(name), " to taste") {
+		notes = append(notes, "to taste")
+		name = strings.TrimSpace(name[:len(name)-len(" to taste")])
+	}
+
+	ingredient.Name = name
+	ingredient.Note = strings.Join(notes, ", ")
+	if ingredient.Name == "" {
+		ingredient.Name = line
+	}
+	return ingredient
+}
+
+// parseQuantityToken reads numbers like "2", "1.5", "1/2", "½", "1½", "2-3"
+// (taking the lower bound) and "200g", which carries its unit along.
+func parseQuantityToken(token string) (float64, string, bool) {
+	// Only numbers, ParseFloat would also take words like "nan" and "infinity"
+	if first, _ := utf8.DecodeRuneInString(token); !unicode.IsDigit(first) {
+		if _, ok := vulgarFractions[first]; !ok {
+			return 0, "", false
+		}
+	}
+	number := token
+	unit := ""
+	if i := strings.IndexFunc(token, unicode.IsLetter); i > 0 {
+		u, ok := parseUnit(token[i:])
+		if !ok {
+			return 0, "", false
+		}
+		number, unit = token[:i], u
+	}
+	if i := strings.IndexAny(number, "-–"); i > 0 {
+		number = number[:i]
+	}
+
+	if parts := strings.Split(number, "/"); len(parts) == 2 {
+		num, errNum := strconv.Atoi(parts[0])
+		den, errDen := strconv.Atoi(parts[1])
+		if errNum != nil || errDen != nil || num < 0 || den <= 0 || !validQuantity(float64(num)/float64(den)) {
+			return 0, "", false
+		}
+		return float64(num) / float64(den), unit, true
+	}
+
+	value := 0.0
+	if r, size := utf8.DecodeLastRuneInString(number); size > 0 {
+		if fraction, ok := vulgarFractions[r]; ok {
+			value = fraction
+			number = number[:len(number)-size]
+			if number == "" {
+				return value, unit, true
+			}
+		}
+	}
+	n, err := strconv.ParseFloat(strings.Replace(number, ",", ".", 1), 64)
+	if err != nil || !validQuantity(n+value) {
+		return 0, "", false
+	}
+	return n + value, unit, true
+}
+
+func validQuantity(quantity float64) bool {
+	return !math.IsNaN(quantity) && !math.IsInf(quantity, 0) && quantity >= 0 && quantity <= maxQuantity
+}
+
+func parseUnit(token string) (string, bool) {
+	token = strings.TrimSuffix(token, ".")
+	// Recipes tell tablespoons from teaspoons by case alone
+	switch token {
+	case "T":
+		return "tbsp", true
+	case "t":
+		return "tsp", true
+	}
+	unit, ok := unitAliases[strings.ToLower(token)]
+	return unit, ok
+}
+
+// trimBullet strips list markers like "-", "*", "•" and "1." or "2)".
+func trimBullet(line string) string {
+	line = strings.TrimLeft(line, "-*•· \t")
+	i := 0
+	for i < len(line) && line[i] >= '0' && line[i] <= '9' {
+		i++
+	}
+	if i > 0 && i < len(line) && (line[i] == '.' || line[i] == ')') && (i+1 == len(line) || line[i+1] == ' ') {
+		line = strings.TrimSpace(line[i+1:])
+	}
+	return line
+}
@@ -3,8 +3,11 @@ package recipe
 import (
 	"github.com/biezhi/gorm-paginator/pagination"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 	"github.com/rithikjain/SocialRecipe/pkg"
 	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"reflect"
+	"time"
 )
 
 type Repository interface {
@@ -16,25 +19,83 @@ type Repository interface {
 
 	FindRecipeByID(recipeID uint) (*entities.Recipe, error)
 
+	FindVisibleRecipe(viewerID, recipeID uint) (*entities.Recipe, error)
+
 	LikeRecipe(userID, recipeID uint) error
 
 	UnlikeRecipe(userID, recipeID uint) error
 
 	GetUsersWhoLiked(recipeID uint, pageNo int) (*pagination.Paginator, error)
 
-	GetAllRecipesOfUser(userID uint, pageNo int) (*pagination.Paginator, error)
+	GetAllRecipesOfUser(userID, viewerID uint, pageNo int) (*pagination.Paginator, error)
 
 	GetUsersFavRecipes(userID uint, pageNo int) (*pagination.Paginator, error)
 
-	GetUserFeed(userID uint, pageNo int) (*pagination.Paginator, error)
+	GetUserFeed(userID uint, filter *Filter, pageNo int) (*pagination.Paginator, error)
+
+	GetAllLatestRecipes(viewerID uint, filter *Filter, pageNo int) (*pagination.Paginator, error)
 
-	GetAllLatestRecipes(pageNo int) (*pagination.Paginator, error)
+	SearchRecipes(viewerID uint, filter *Filter, pageNo int) (*pagination.Paginator, error)
 
-	SearchRecipes(query string, pageNo int) (*pagination.Paginator, error)
+	GetPopularTags(kind string, limit int) ([]PopularTag, error)
+
+	GetRecipesByTag(viewerID uint, kind, slug string, pageNo int) (*pagination.Paginator, error)
 
 	DeleteRecipe(recipeID uint) error
 
 	HasUserLiked(userID, recipeID uint) (bool, error)
+
+	GetRecipesWithLegacyIngredients(limit int) ([]entities.Recipe, error)
+
+	ConvertLegacyIngredients(recipe *entities.Recipe, ingredients []entities.Ingredient) error
+
+	GetRecipesWithLegacyProcedure(limit int) ([]entities.Recipe, error)
+
+	ConvertLegacyProcedure(recipe *entities.Recipe, steps []entities.Step) error
+
+	GetRecipesWithStaleNutrition(version, limit int) ([]entities.Recipe, error)
+
+	SaveNutrition(recipe *entities.Recipe) error
+
+	GetRecipesWithStaleDietaryLabels(version string, limit int) ([]entities.Recipe, error)
+
+	SaveDietaryLabels(recipe *entities.Recipe) error
+
+	GetSteps(recipeID uint) ([]entities.Step, error)
+
+	InsertStep(step *entities.Step) error
+
+	DeleteStep(recipeID, stepID uint) error
+
+	ReorderSteps(recipeID uint, stepIDs []uint) error
+
+	GetImages(recipeID uint) ([]entities.RecipeImage, error)
+
+	InsertImage(image *entities.RecipeImage) error
+
+	UpdateImage(image *entities.RecipeImage) error
+
+	ReplaceCoverImage(image *entities.RecipeImage) error
+
+	DeleteImage(recipeID, imageID uint) error
+
+	ReorderImages(recipeID uint, imageIDs []uint) error
+
+	GetRecipesWithoutImages(limit int) ([]entities.Recipe, error)
+
+	GetRevisions(recipeID uint, pageNo int) (*pagination.Paginator, error)
+
+	GetRevision(recipeID uint, number int) (*entities.RecipeRevision, error)
+
+	SaveRevision(recipeID uint) error
+
+	GetRecipesWithoutRevisions(limit int) ([]entities.Recipe, error)
+
+	GetForks(viewerID, recipeID uint, pageNo int) (*pagination.Paginator, error)
+
+	PublishScheduledRecipes(now time.Time) (int, error)
+
+	SetPublishedDates() (int, error)
 }
 
 type repo struct {
@@ -48,16 +109,67 @@ func NewRepo(db *gorm.DB) Repository {
 }
 
 func (r *repo) CreateRecipe(recipe *entities.Recipe) (*entities.Recipe, error) {
-	result := r.DB.Create(recipe)
-	if result.Error != nil {
+	tx := r.DB.Begin()
+	if err := tx.Set("gorm:save_associations", false).Create(recipe).Error; err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	if err := replaceIngredients(tx, recipe.ID, recipe.Ingredients); err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	if err := replaceSteps(tx, recipe.ID, recipe.Steps); err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	if err := replaceTags(tx, recipe.ID, recipe.Tags); err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	for i := range recipe.Images {
+		recipe.Images[i].RecipeID = recipe.ID
+		if err := tx.Create(&recipe.Images[i]).Error; err != nil {
+			tx.Rollback()
+			return nil, pkg.ErrDatabase
+		}
+	}
+	if err := saveRevision(tx, recipe.ID); err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
 		return nil, pkg.ErrDatabase
 	}
 	return recipe, nil
 }
 
+// UpdateRecipe saves the recipe and replaces its ingredients, steps and tags
+// with the ones it holds now, keeping the result as a new revision. Images
+// are edited on their own, so the cover is left as it is.
 func (r *repo) UpdateRecipe(recipe *entities.Recipe) (*entities.Recipe, error) {
-	result := r.DB.Save(recipe)
-	if result.Error != nil {
+	tx := r.DB.Begin()
+	err := tx.Set("gorm:save_associations", false).Omit(coverColumns...).Save(recipe).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	if err := replaceIngredients(tx, recipe.ID, recipe.Ingredients); err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	if err := replaceSteps(tx, recipe.ID, recipe.Steps); err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	if err := replaceTags(tx, recipe.ID, recipe.Tags); err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	if err := saveRevision(tx, recipe.ID); err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
 		return nil, pkg.ErrDatabase
 	}
 	return recipe, nil
@@ -74,13 +186,28 @@ func (r *repo) FindUserByID(id uint) (*entities.User, error) {
 
 func (r *repo) FindRecipeByID(recipeID uint) (*entities.Recipe, error) {
 	recipe := &entities.Recipe{}
-	err := r.DB.Where("id = ?", recipeID).First(recipe).Error
+	err := withDetails(r.DB).Where("id = ?", recipeID).First(recipe).Error
 	if err != nil {
 		return nil, pkg.ErrDatabase
 	}
 	return recipe, nil
 }
 
+// FindVisibleRecipe finds the recipe if the viewer may see it, which they may
+// always for their own recipes.
+func (r *repo) FindVisibleRecipe(viewerID, recipeID uint) (*entities.Recipe, error) {
+	recipe := &entities.Recipe{}
+	result := withDetails(r.DB).Where("id = ?", recipeID).
+		Where("user_id = ? or ("+visibleTo+")", viewerID, viewerID, viewerID).First(recipe)
+	if result.RecordNotFound() {
+		return nil, pkg.ErrNotFound
+	}
+	if result.Error != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return recipe, nil
+}
+
 func (r *repo) LikeRecipe(userID, recipeID uint) error {
 	recipe := &entities.Recipe{}
 	err := r.DB.Where("id = ?", recipeID).First(recipe).Error
@@ -146,14 +273,21 @@ func (r *repo) GetUsersWhoLiked(recipeID uint, pageNo int) (*pagination.Paginato
 	return page, nil
 }
 
-func (r *repo) GetAllRecipesOfUser(userID uint, pageNo int) (*pagination.Paginator, error) {
+// GetAllRecipesOfUser lists every recipe of the user to themselves, drafts
+// included, and the published ones the viewer may see to anyone else.
+func (r *repo) GetAllRecipesOfUser(userID, viewerID uint, pageNo int) (*pagination.Paginator, error) {
 	var recipes []entities.Recipe
-	stmt := r.DB.Where("user_id = ?", userID)
+	stmt := withDetails(r.DB).Where("user_id = ?", userID)
+	orderBy := []string{"created_at desc"}
+	if userID != viewerID {
+		stmt = stmt.Where(visibleTo, viewerID, viewerID)
+		orderBy = []string{"published_at desc"}
+	}
 	page := pagination.Paging(&pagination.Param{
 		DB:      stmt,
 		Page:    pageNo,
 		Limit:   7,
-		OrderBy: []string{"created_at desc"},
+		OrderBy: orderBy,
 	}, &recipes)
 	return page, nil
 }
@@ -172,7 +306,7 @@ func (r *repo) GetUsersFavRecipes(userID uint, pageNo int) (*pagination.Paginato
 	}
 
 	var recipes []entities.Recipe
-	stmt := r.DB.Where(favouriteRecipeIDs)
+	stmt := withDetails(r.DB).Where(favouriteRecipeIDs).Where(visibleTo, userID, userID)
 	page := pagination.Paging(&pagination.Param{
 		DB:      stmt,
 		Page:    pageNo,
@@ -182,7 +316,7 @@ func (r *repo) GetUsersFavRecipes(userID uint, pageNo int) (*pagination.Paginato
 	return page, nil
 }
 
-func (r *repo) GetUserFeed(userID uint, pageNo int) (*pagination.Paginator, error) {
+func (r *repo) GetUserFeed(userID uint, filter *Filter, pageNo int) (*pagination.Paginator, error) {
 	var followings []entities.Following
 	if err := r.DB.Where("user_id = ?", userID).Find(&followings).Error; err != nil {
 		return nil, pkg.ErrDatabase
@@ -194,36 +328,75 @@ func (r *repo) GetUserFeed(userID uint, pageNo int) (*pagination.Paginator, erro
 	}
 
 	var recipes []entities.Recipe
-	stmt := r.DB.Where("user_id in (?)", otherUserIDs)
+	stmt := applyFilter(withDetails(r.DB), filter).Where("user_id in (?)", otherUserIDs).Where(visibleTo, userID, userID)
 	page := pagination.Paging(&pagination.Param{
 		DB:      stmt,
 		Page:    pageNo,
 		Limit:   7,
-		OrderBy: []string{"created_at desc"},
+		OrderBy: filter.orderBy(),
 	}, &recipes)
 	return page, nil
 }
 
-func (r *repo) GetAllLatestRecipes(pageNo int) (*pagination.Paginator, error) {
+func (r *repo) GetAllLatestRecipes(viewerID uint, filter *Filter, pageNo int) (*pagination.Paginator, error) {
 	var recipes []entities.Recipe
-	stmt := r.DB
+	stmt := applyFilter(withDetails(r.DB), filter).Where(visibleTo, viewerID, viewerID)
 	page := pagination.Paging(&pagination.Param{
 		DB:      stmt,
 		Page:    pageNo,
 		Limit:   7,
-		OrderBy: []string{"created_at desc"},
+		OrderBy: filter.orderBy(),
 	}, &recipes)
 	return page, nil
 }
 
-func (r *repo) SearchRecipes(query string, pageNo int) (*pagination.Paginator, error) {
+func (r *repo) SearchRecipes(viewerID uint, filter *Filter, pageNo int) (*pagination.Paginator, error) {
 	var recipes []entities.Recipe
-	stmt := r.DB.Where("lower(recipe_name) LIKE ?", "%"+query+"%")
+	stmt := applyFilter(withDetails(r.DB), filter).Where(visibleTo, viewerID, viewerID)
 	page := pagination.Paging(&pagination.Param{
 		DB:      stmt,
 		Page:    pageNo,
 		Limit:   7,
-		OrderBy: []string{"created_at desc"},
+		OrderBy: filter.orderBy(),
+	}, &recipes)
+	return page, nil
+}
+
+// Condition for recipes carrying the tag of a kind and slug
+const taggedWith = "id in (select recipe_tags.recipe_id from recipe_tags join tags on tags.id = recipe_tags.tag_id where tags.kind = ? and tags.slug = ?)"
+
+// Condition for recipes the viewer may find in listings: public ones and the
+// followers only ones of authors they follow or of their own. Drafts, private
+// and scheduled recipes are left out, even for their author.
+const visibleTo = "publish_at is null and (visibility = 'public' or (visibility = 'followers' and (user_id = ? or user_id in (select others_user_id from followings where user_id = ?))))"
+
+func (r *repo) GetPopularTags(kind string, limit int) ([]PopularTag, error) {
+	var popular []PopularTag
+	stmt := r.DB.Table("tags").
+		Select("tags.kind, tags.slug, tags.name, count(*) as recipes").
+		Joins("join recipe_tags on recipe_tags.tag_id = tags.id").
+		Joins("join recipes on recipes.id = recipe_tags.recipe_id and recipes.visibility = ? and recipes.publish_at is null", entities.VisibilityPublic)
+	if kind != "" {
+		stmt = stmt.Where("tags.kind = ?", kind)
+	}
+	err := stmt.Group("tags.id, tags.kind, tags.slug, tags.name").
+		Order("recipes desc, tags.name asc").
+		Limit(limit).
+		Scan(&popular).Error
+	if err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return popular, nil
+}
+
+func (r *repo) GetRecipesByTag(viewerID uint, kind, slug string, pageNo int) (*pagination.Paginator, error) {
+	var recipes []entities.Recipe
+	stmt := withDetails(r.DB).Where(taggedWith, kind, slug).Where(visibleTo, viewerID, viewerID)
+	page := pagination.Paging(&pagination.Param{
+		DB:      stmt,
+		Page:    pageNo,
+		Limit:   7,
+		OrderBy: []string{"published_at desc"},
 	}, &recipes)
 	return page, nil
 }
@@ -234,8 +407,32 @@ func (r *repo) DeleteRecipe(recipeID uint) error {
 	if err != nil {
 		return pkg.ErrDatabase
 	}
-	err = r.DB.Unscoped().Delete(recipe).Error
-	if err != nil {
+	tx := r.DB.Begin()
+	if err := tx.Where("recipe_id = ?", recipe.ID).Unscoped().Delete(&entities.Ingredient{}).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := replaceSteps(tx, recipe.ID, nil); err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := replaceTags(tx, recipe.ID, nil); err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := deleteImages(tx, recipe); err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Where("recipe_id = ?", recipe.ID).Unscoped().Delete(&entities.RecipeRevision{}).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Unscoped().Delete(recipe).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
 		return pkg.ErrDatabase
 	}
 	return nil
@@ -252,3 +449,814 @@ func (r *repo) HasUserLiked(userID, recipeID uint) (bool, error) {
 	}
 	return true, nil
 }
+
+func (r *repo) GetRecipesWithLegacyIngredients(limit int) ([]entities.Recipe, error) {
+	var recipes []entities.Recipe
+	if err := r.DB.Where("ingredients <> ''").Limit(limit).Find(&recipes).Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return recipes, nil
+}
+
+// ConvertLegacyIngredients stores the parsed ingredients of a recipe and
+// empties its free text ingredients, so each recipe is converted only once.
+func (r *repo) ConvertLegacyIngredients(recipe *entities.Recipe, ingredients []entities.Ingredient) error {
+	tx := r.DB.Begin()
+	if err := replaceIngredients(tx, recipe.ID, ingredients); err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	err := tx.Model(&entities.Recipe{}).Where("id = ?", recipe.ID).UpdateColumn("ingredients", "").Error
+	if err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func replaceIngredients(tx *gorm.DB, recipeID uint, ingredients []entities.Ingredient) error {
+	if err := tx.Where("recipe_id = ?", recipeID).Unscoped().Delete(&entities.Ingredient{}).Error; err != nil {
+		return err
+	}
+	for i := range ingredients {
+		ingredients[i].ID = 0
+		ingredients[i].RecipeID = recipeID
+		if err := tx.Create(&ingredients[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *repo) GetRecipesWithLegacyProcedure(limit int) ([]entities.Recipe, error) {
+	var recipes []entities.Recipe
+	if err := r.DB.Where("procedure <> ''").Limit(limit).Find(&recipes).Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return recipes, nil
+}
+
+// ConvertLegacyProcedure stores the steps split from the procedure of a
+// recipe and empties its free text procedure.
+func (r *repo) ConvertLegacyProcedure(recipe *entities.Recipe, steps []entities.Step) error {
+	tx := r.DB.Begin()
+	if err := replaceSteps(tx, recipe.ID, steps); err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	err := tx.Model(&entities.Recipe{}).Where("id = ?", recipe.ID).UpdateColumn("procedure", "").Error
+	if err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) GetRecipesWithStaleNutrition(version, limit int) ([]entities.Recipe, error) {
+	var recipes []entities.Recipe
+	err := r.DB.Preload("Ingredients").Where("nutrition_version <> ?", version).Limit(limit).Find(&recipes).Error
+	if err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return recipes, nil
+}
+
+// SaveNutrition stores a recalculated estimate without touching updated_at,
+// since the recipe itself did not change.
+func (r *repo) SaveNutrition(recipe *entities.Recipe) error {
+	err := r.DB.Model(&entities.Recipe{}).Where("id = ?", recipe.ID).UpdateColumns(map[string]interface{}{
+		"nutrition_calories":              recipe.Nutrition.Calories,
+		"nutrition_protein":               recipe.Nutrition.Protein,
+		"nutrition_fat":                   recipe.Nutrition.Fat,
+		"nutrition_carbohydrates":         recipe.Nutrition.Carbohydrates,
+		"nutrition_fiber":                 recipe.Nutrition.Fiber,
+		"serving_nutrition_calories":      recipe.NutritionPerServing.Calories,
+		"serving_nutrition_protein":       recipe.NutritionPerServing.Protein,
+		"serving_nutrition_fat":           recipe.NutritionPerServing.Fat,
+		"serving_nutrition_carbohydrates": recipe.NutritionPerServing.Carbohydrates,
+		"serving_nutrition_fiber":         recipe.NutritionPerServing.Fiber,
+		"nutrition_coverage":              recipe.NutritionCoverage,
+		"nutrition_version":               recipe.NutritionVersion,
+	}).Error
+	if err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) GetRecipesWithStaleDietaryLabels(version string, limit int) ([]entities.Recipe, error) {
+	var recipes []entities.Recipe
+	err := r.DB.Preload("Ingredients").Where("dietary_version is null or dietary_version <> ?", version).Limit(limit).Find(&recipes).Error
+	if err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return recipes, nil
+}
+
+// SaveDietaryLabels stores recalculated labels without touching updated_at
+func (r *repo) SaveDietaryLabels(recipe *entities.Recipe) error {
+	err := r.DB.Model(&entities.Recipe{}).Where("id = ?", recipe.ID).UpdateColumns(map[string]interface{}{
+		"dietary_labels":  recipe.DietaryLabels,
+		"allergens":       recipe.Allergens,
+		"dietary_version": recipe.DietaryVersion,
+	}).Error
+	if err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) GetSteps(recipeID uint) ([]entities.Step, error) {
+	var steps []entities.Step
+	if err := r.DB.Where("recipe_id = ?", recipeID).Order("position asc").Find(&steps).Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return steps, nil
+}
+
+// InsertStep puts the step at its position, moving the steps from there on
+// one down. Positions past the end append the step.
+func (r *repo) InsertStep(step *entities.Step) error {
+	tx := r.DB.Begin()
+	count, err := lockSteps(tx, step.RecipeID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if step.Position < 0 || step.Position > count {
+		step.Position = count
+	}
+	err = tx.Model(&entities.Step{}).
+		Where("recipe_id = ? and position >= ?", step.RecipeID, step.Position).
+		UpdateColumn("position", gorm.Expr("position + 1")).Error
+	if err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Create(step).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := saveRevision(tx, step.RecipeID); err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) DeleteStep(recipeID, stepID uint) error {
+	tx := r.DB.Begin()
+	if _, err := lockSteps(tx, recipeID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	step := &entities.Step{}
+	result := tx.Where("id = ? and recipe_id = ?", stepID, recipeID).First(step)
+	if result.RecordNotFound() {
+		tx.Rollback()
+		return pkg.ErrNotFound
+	}
+	if result.Error != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Unscoped().Delete(step).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	err := tx.Model(&entities.Step{}).
+		Where("recipe_id = ? and position > ?", recipeID, step.Position).
+		UpdateColumn("position", gorm.Expr("position - 1")).Error
+	if err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := queueImageDeletion(tx, step.ImgPublicId); err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := saveRevision(tx, recipeID); err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+// ReorderSteps numbers the steps of a recipe in the order of stepIDs, which
+// has to name every step exactly once.
+func (r *repo) ReorderSteps(recipeID uint, stepIDs []uint) error {
+	tx := r.DB.Begin()
+	if _, err := lockSteps(tx, recipeID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	var steps []entities.Step
+	if err := tx.Where("recipe_id = ?", recipeID).Find(&steps).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	positions := make(map[uint]int, len(stepIDs))
+	for i, id := range stepIDs {
+		positions[id] = i
+	}
+	if len(positions) != len(steps) || len(stepIDs) != len(steps) {
+		tx.Rollback()
+		return pkg.ErrSteps
+	}
+	for _, step := range steps {
+		position, ok := positions[step.ID]
+		if !ok {
+			tx.Rollback()
+			return pkg.ErrSteps
+		}
+		if err := tx.Model(&step).UpdateColumn("position", position).Error; err != nil {
+			tx.Rollback()
+			return pkg.ErrDatabase
+		}
+	}
+	if err := saveRevision(tx, recipeID); err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) GetImages(recipeID uint) ([]entities.RecipeImage, error) {
+	var images []entities.RecipeImage
+	if err := r.DB.Where("recipe_id = ?", recipeID).Order("position asc").Find(&images).Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return images, nil
+}
+
+// InsertImage puts the image at its position like InsertStep. The first image
+// of a recipe always becomes its cover.
+func (r *repo) InsertImage(image *entities.RecipeImage) error {
+	tx := r.DB.Begin()
+	count, err := lockImages(tx, image.RecipeID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count >= maxImages {
+		tx.Rollback()
+		return pkg.ErrImages
+	}
+	if image.Position < 0 || image.Position > count {
+		image.Position = count
+	}
+	err = tx.Model(&entities.RecipeImage{}).
+		Where("recipe_id = ? and position >= ?", image.RecipeID, image.Position).
+		UpdateColumn("position", gorm.Expr("position + 1")).Error
+	if err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	cover := image.Cover || count == 0
+	image.Cover = false
+	if err := tx.Create(image).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if cover {
+		if err := setCover(tx, image.RecipeID, image.ID); err != nil {
+			tx.Rollback()
+			return pkg.ErrDatabase
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+// UpdateImage saves the alt text of the image and makes it the cover if it
+// is marked as one. The cover cannot be unmarked, only replaced.
+func (r *repo) UpdateImage(image *entities.RecipeImage) error {
+	tx := r.DB.Begin()
+	if _, err := lockImages(tx, image.RecipeID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	existing, err := findImage(tx, image.RecipeID, image.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Model(existing).UpdateColumn("alt_text", image.AltText).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if image.Cover && !existing.Cover {
+		if err := setCover(tx, image.RecipeID, image.ID); err != nil {
+			tx.Rollback()
+			return pkg.ErrDatabase
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+// ReplaceCoverImage swaps the file of the cover for the one of image and
+// queues the old file for deletion. A recipe without images gets image as
+// its first one.
+func (r *repo) ReplaceCoverImage(image *entities.RecipeImage) error {
+	tx := r.DB.Begin()
+	if _, err := lockImages(tx, image.RecipeID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	cover := &entities.RecipeImage{}
+	result := tx.Where("recipe_id = ? and cover = ?", image.RecipeID, true).First(cover)
+	if result.Error != nil && !result.RecordNotFound() {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if result.RecordNotFound() {
+		image.Position = 0
+		image.Cover = true
+		if err := tx.Create(image).Error; err != nil {
+			tx.Rollback()
+			return pkg.ErrDatabase
+		}
+	} else {
+		if err := queueImageDeletion(tx, cover.ImgPublicId); err != nil {
+			tx.Rollback()
+			return pkg.ErrDatabase
+		}
+		columns := imageColumns(image)
+		columns["alt_text"] = image.AltText
+		err := tx.Model(cover).UpdateColumns(columns).Error
+		if err != nil {
+			tx.Rollback()
+			return pkg.ErrDatabase
+		}
+	}
+	if err := syncCover(tx, image.RecipeID); err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+// DeleteImage removes an image and queues its file for deletion. The last
+// image of a recipe cannot be removed, when the cover goes the image that
+// moves up to the front becomes the cover.
+func (r *repo) DeleteImage(recipeID, imageID uint) error {
+	tx := r.DB.Begin()
+	count, err := lockImages(tx, recipeID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	image, err := findImage(tx, recipeID, imageID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count <= 1 {
+		tx.Rollback()
+		return pkg.ErrImages
+	}
+	if err := tx.Unscoped().Delete(image).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	err = tx.Model(&entities.RecipeImage{}).
+		Where("recipe_id = ? and position > ?", recipeID, image.Position).
+		UpdateColumn("position", gorm.Expr("position - 1")).Error
+	if err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := queueImageDeletion(tx, image.ImgPublicId); err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if image.Cover {
+		first := &entities.RecipeImage{}
+		if err := tx.Where("recipe_id = ?", recipeID).Order("position asc").First(first).Error; err != nil {
+			tx.Rollback()
+			return pkg.ErrDatabase
+		}
+		if err := setCover(tx, recipeID, first.ID); err != nil {
+			tx.Rollback()
+			return pkg.ErrDatabase
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+// ReorderImages numbers the images of a recipe in the order of imageIDs,
+// which has to name every image exactly once.
+func (r *repo) ReorderImages(recipeID uint, imageIDs []uint) error {
+	tx := r.DB.Begin()
+	if _, err := lockImages(tx, recipeID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	var images []entities.RecipeImage
+	if err := tx.Where("recipe_id = ?", recipeID).Find(&images).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	positions := make(map[uint]int, len(imageIDs))
+	for i, id := range imageIDs {
+		positions[id] = i
+	}
+	if len(positions) != len(images) || len(imageIDs) != len(images) {
+		tx.Rollback()
+		return pkg.ErrImages
+	}
+	for _, image := range images {
+		position, ok := positions[image.ID]
+		if !ok {
+			tx.Rollback()
+			return pkg.ErrImages
+		}
+		if err := tx.Model(&image).UpdateColumn("position", position).Error; err != nil {
+			tx.Rollback()
+			return pkg.ErrDatabase
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+// GetRecipesWithoutImages finds recipes from before galleries, whose only
+// image is the one stored on the recipe.
+func (r *repo) GetRecipesWithoutImages(limit int) ([]entities.Recipe, error) {
+	var recipes []entities.Recipe
+	err := r.DB.Where("img_url <> '' and id not in (select recipe_id from recipe_images)").Limit(limit).Find(&recipes).Error
+	if err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return recipes, nil
+}
+
+func (r *repo) GetRevisions(recipeID uint, pageNo int) (*pagination.Paginator, error) {
+	var revisions []entities.RecipeRevision
+	stmt := r.DB.Where("recipe_id = ?", recipeID)
+	page := pagination.Paging(&pagination.Param{
+		DB:      stmt,
+		Page:    pageNo,
+		Limit:   10,
+		OrderBy: []string{"number desc"},
+	}, &revisions)
+	return page, nil
+}
+
+func (r *repo) GetRevision(recipeID uint, number int) (*entities.RecipeRevision, error) {
+	revision := &entities.RecipeRevision{}
+	result := r.DB.Where("recipe_id = ? and number = ?", recipeID, number).First(revision)
+	if result.RecordNotFound() {
+		return nil, pkg.ErrNotFound
+	}
+	if result.Error != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return revision, nil
+}
+
+// SaveRevision keeps the recipe as it is now as its newest revision.
+func (r *repo) SaveRevision(recipeID uint) error {
+	tx := r.DB.Begin()
+	if err := lockRecipe(tx, recipeID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := saveRevision(tx, recipeID); err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+// GetRecipesWithoutRevisions finds recipes from before revisions were kept.
+func (r *repo) GetRecipesWithoutRevisions(limit int) ([]entities.Recipe, error) {
+	var recipes []entities.Recipe
+	err := r.DB.Where("id not in (select recipe_id from recipe_revisions)").Limit(limit).Find(&recipes).Error
+	if err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return recipes, nil
+}
+
+func (r *repo) GetForks(viewerID, recipeID uint, pageNo int) (*pagination.Paginator, error) {
+	var recipes []entities.Recipe
+	stmt := withDetails(r.DB).Where("forked_from_id = ?", recipeID).Where(visibleTo, viewerID, viewerID)
+	page := pagination.Paging(&pagination.Param{
+		DB:      stmt,
+		Page:    pageNo,
+		Limit:   7,
+		OrderBy: []string{"published_at desc"},
+	}, &recipes)
+	return page, nil
+}
+
+// PublishScheduledRecipes publishes the recipes whose publish time has come,
+// as of then. It returns how many recipes were published.
+func (r *repo) PublishScheduledRecipes(now time.Time) (int, error) {
+	result := r.DB.Model(&entities.Recipe{}).Where("publish_at <= ?", now).UpdateColumns(map[string]interface{}{
+		"published_at": gorm.Expr("publish_at"),
+		"publish_at":   nil,
+	})
+	if result.Error != nil {
+		return 0, pkg.ErrDatabase
+	}
+	return int(result.RowsAffected), nil
+}
+
+// SetPublishedDates dates recipes from before visibility was kept as
+// published when they were created.
+func (r *repo) SetPublishedDates() (int, error) {
+	result := r.DB.Model(&entities.Recipe{}).
+		Where("published_at is null and publish_at is null and visibility in (?)",
+			[]string{entities.VisibilityFollowers, entities.VisibilityPublic}).
+		UpdateColumn("published_at", gorm.Expr("created_at"))
+	if result.Error != nil {
+		return 0, pkg.ErrDatabase
+	}
+	return int(result.RowsAffected), nil
+}
+
+// lockSteps locks the recipe so concurrent edits of its steps cannot mix up
+// their positions, and returns how many steps it has.
+func lockSteps(tx *gorm.DB, recipeID uint) (int, error) {
+	if err := lockRecipe(tx, recipeID); err != nil {
+		return 0, err
+	}
+	count := 0
+	if err := tx.Model(&entities.Step{}).Where("recipe_id = ?", recipeID).Count(&count).Error; err != nil {
+		return 0, pkg.ErrDatabase
+	}
+	return count, nil
+}
+
+// lockImages locks the recipe like lockSteps and returns how many images it
+// has.
+func lockImages(tx *gorm.DB, recipeID uint) (int, error) {
+	if err := lockRecipe(tx, recipeID); err != nil {
+		return 0, err
+	}
+	count := 0
+	if err := tx.Model(&entities.RecipeImage{}).Where("recipe_id = ?", recipeID).Count(&count).Error; err != nil {
+		return 0, pkg.ErrDatabase
+	}
+	return count, nil
+}
+
+func lockRecipe(tx *gorm.DB, recipeID uint) error {
+	result := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", recipeID).First(&entities.Recipe{})
+	if result.RecordNotFound() {
+		return pkg.ErrNotFound
+	}
+	if result.Error != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+// replaceSteps swaps the steps of a recipe for the given ones. A step keeps
+// the image of the existing step whose ID it carries, or else of one with
+// the same text, as clients sending a procedure or no IDs cannot tell which
+// step is which. The images of steps that are gone are queued for deletion.
+func replaceSteps(tx *gorm.DB, recipeID uint, steps []entities.Step) error {
+	var existing []entities.Step
+	if err := tx.Where("recipe_id = ?", recipeID).Order("position asc").Find(&existing).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("recipe_id = ?", recipeID).Unscoped().Delete(&entities.Step{}).Error; err != nil {
+		return err
+	}
+
+	byID := make(map[uint]entities.Step, len(existing))
+	for _, step := range existing {
+		byID[step.ID] = step
+	}
+	matched := make([]*entities.Step, len(steps))
+	for i := range steps {
+		if old, ok := byID[steps[i].ID]; ok {
+			matched[i] = &old
+			delete(byID, old.ID)
+		}
+	}
+	for i := range steps {
+		if matched[i] != nil {
+			continue
+		}
+		for _, old := range existing {
+			if _, ok := byID[old.ID]; ok && old.Text == steps[i].Text {
+				old := old
+				matched[i] = &old
+				delete(byID, old.ID)
+				break
+			}
+		}
+	}
+
+	for i := range steps {
+		if old := matched[i]; old != nil {
+			steps[i].ImgUrl = old.ImgUrl
+			steps[i].ImgPublicId = old.ImgPublicId
+			steps[i].ImgVariants = old.ImgVariants
+		}
+		steps[i].ID = 0
+		steps[i].RecipeID = recipeID
+		if err := tx.Create(&steps[i]).Error; err != nil {
+			return err
+		}
+	}
+	for _, gone := range byID {
+		if err := queueImageDeletion(tx, gone.ImgPublicId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceTags swaps the tags of a recipe for the given ones, creating the tags
+// nobody used before.
+func replaceTags(tx *gorm.DB, recipeID uint, tags []entities.Tag) error {
+	if err := tx.Exec("DELETE FROM recipe_tags WHERE recipe_id = ?", recipeID).Error; err != nil {
+		return err
+	}
+	for i := range tags {
+		tag := &tags[i]
+		err := tx.Where("kind = ? and slug = ?", tag.Kind, tag.Slug).Attrs(entities.Tag{Name: tag.Name}).FirstOrCreate(tag).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("INSERT INTO recipe_tags (recipe_id, tag_id) VALUES (?, ?)", recipeID, tag.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findImage(tx *gorm.DB, recipeID, imageID uint) (*entities.RecipeImage, error) {
+	image := &entities.RecipeImage{}
+	result := tx.Where("id = ? and recipe_id = ?", imageID, recipeID).First(image)
+	if result.RecordNotFound() {
+		return nil, pkg.ErrNotFound
+	}
+	if result.Error != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return image, nil
+}
+
+// setCover makes the image the only cover of the recipe.
+func setCover(tx *gorm.DB, recipeID, imageID uint) error {
+	err := tx.Model(&entities.RecipeImage{}).Where("recipe_id = ?", recipeID).
+		UpdateColumn("cover", gorm.Expr("id = ?", imageID)).Error
+	if err != nil {
+		return err
+	}
+	return syncCover(tx, recipeID)
+}
+
+// syncCover copies the cover onto the recipe, where the listings read it from.
+func syncCover(tx *gorm.DB, recipeID uint) error {
+	cover := &entities.RecipeImage{}
+	result := tx.Where("recipe_id = ? and cover = ?", recipeID, true).First(cover)
+	if result.Error != nil && !result.RecordNotFound() {
+		return result.Error
+	}
+	return tx.Model(&entities.Recipe{}).Where("id = ?", recipeID).UpdateColumns(imageColumns(cover)).Error
+}
+
+// The columns recipes and their images keep the cover in
+var coverColumns = []string{"img_url", "img_public_id", "img_thumbnail", "img_small", "img_medium", "img_large"}
+
+func imageColumns(image *entities.RecipeImage) map[string]interface{} {
+	return map[string]interface{}{
+		"img_url":       image.ImgUrl,
+		"img_public_id": image.ImgPublicId,
+		"img_thumbnail": image.ImgVariants.Thumbnail,
+		"img_small":     image.ImgVariants.Small,
+		"img_medium":    image.ImgVariants.Medium,
+		"img_large":     image.ImgVariants.Large,
+	}
+}
+
+// deleteImages removes the gallery of a recipe and queues every file of it
+// for deletion, along with the image stored on the recipe in case it predates
+// the gallery.
+func deleteImages(tx *gorm.DB, recipe *entities.Recipe) error {
+	var images []entities.RecipeImage
+	if err := tx.Where("recipe_id = ?", recipe.ID).Find(&images).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("recipe_id = ?", recipe.ID).Unscoped().Delete(&entities.RecipeImage{}).Error; err != nil {
+		return err
+	}
+	publicIDs := []string{recipe.ImgPublicId}
+	for _, image := range images {
+		publicIDs = append(publicIDs, image.ImgPublicId)
+	}
+	queued := map[string]bool{"": true}
+	for _, publicID := range publicIDs {
+		if queued[publicID] {
+			continue
+		}
+		queued[publicID] = true
+		if err := queueImageDeletion(tx, publicID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveRevision adds the recipe as it is in tx to its revisions, unless its
+// content is the same as in the newest revision.
+func saveRevision(tx *gorm.DB, recipeID uint) error {
+	recipe := &entities.Recipe{}
+	if err := withDetails(tx).Where("id = ?", recipeID).First(recipe).Error; err != nil {
+		return err
+	}
+	content := snapshot(recipe)
+
+	last := &entities.RecipeRevision{}
+	result := tx.Where("recipe_id = ?", recipeID).Order("number desc").First(last)
+	if result.Error != nil && !result.RecordNotFound() {
+		return result.Error
+	}
+	if last.Number > 0 && reflect.DeepEqual(last.Content, content) {
+		return nil
+	}
+	return tx.Create(&entities.RecipeRevision{
+		RecipeID: recipeID,
+		Number:   last.Number + 1,
+		Content:  content,
+	}).Error
+}
+
+// queueImageDeletion leaves the image to the background job that deletes
+// images from the image host.
+func queueImageDeletion(tx *gorm.DB, publicID string) error {
+	if publicID == "" {
+		return nil
+	}
+	return tx.Create(&entities.ImageDeletion{PublicID: publicID}).Error
+}
+
+func applyFilter(db *gorm.DB, filter *Filter) *gorm.DB {
+	if filter.Query != "" {
+		db = db.Where(
+			"lower(recipe_name) LIKE ? or id in (select recipe_id from ingredients where lower(name) LIKE ?)",
+			"%"+filter.Query+"%", "%"+filter.Query+"%",
+		)
+	}
+	for _, tag := range filter.Tags {
+		db = db.Where(taggedWith, tag.Kind, tag.Slug)
+	}
+	if len(filter.Labels) > 0 {
+		db = db.Where("dietary_labels @> ?", pq.StringArray(filter.Labels))
+	}
+	if filter.MaxTotalTime > 0 {
+		db = db.Where("total_time > 0 and total_time <= ?", filter.MaxTotalTime)
+	}
+	return db
+}
+
+// Ingredients, steps and images are listed in the order the author gave them
+func withDetails(db *gorm.DB) *gorm.DB {
+	return db.Preload("Ingredients", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	}).Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	}).Preload("Images", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	}).Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("tags.kind asc, tags.name asc")
+	})
+}
@@ -0,0 +1,101 @@
+package recipe
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"reflect"
+	"strings"
+)
+
+// Change is one field that differs between two revisions
+type Change struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// snapshot copies what a revision keeps of the recipe. IDs and timestamps of
+// ingredients, steps and tags are left out, they change with every save and
+// would make every revision look different from the one before.
+func snapshot(recipe *entities.Recipe) entities.RevisionContent {
+	content := entities.RevisionContent{
+		RecipeName:    recipe.RecipeName,
+		Description:   recipe.Description,
+		Ingredients:   []entities.Ingredient{},
+		Difficulty:    recipe.Difficulty,
+		Servings:      recipe.Servings,
+		PrepTime:      recipe.PrepTime,
+		CookTime:      recipe.CookTime,
+		RestTime:      recipe.RestTime,
+		Steps:         []entities.Step{},
+		Tags:          []entities.Tag{},
+		AddedLabels:   append(pq.StringArray{}, recipe.AddedLabels...),
+		RemovedLabels: append(pq.StringArray{}, recipe.RemovedLabels...),
+	}
+	for _, ingredient := range recipe.Ingredients {
+		ingredient.Model = gorm.Model{}
+		ingredient.RecipeID = 0
+		content.Ingredients = append(content.Ingredients, ingredient)
+	}
+	for _, step := range recipe.Steps {
+		content.Steps = append(content.Steps, entities.Step{
+			Position:        step.Position,
+			Text:            step.Text,
+			DurationSeconds: step.DurationSeconds,
+		})
+	}
+	for _, tag := range recipe.Tags {
+		content.Tags = append(content.Tags, entities.Tag{Kind: tag.Kind, Slug: tag.Slug, Name: tag.Name})
+	}
+	return content
+}
+
+// Diff lists the fields that changed from one revision to the other, under
+// their JSON names. Lists like the ingredients are compared as a whole.
+func Diff(from, to entities.RevisionContent) []Change {
+	changes := []Change{}
+	a, b := reflect.ValueOf(from), reflect.ValueOf(to)
+	for i := 0; i < a.NumField(); i++ {
+		if reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			continue
+		}
+		name := strings.Split(a.Type().Field(i).Tag.Get("json"), ",")[0]
+		changes = append(changes, Change{
+			Field: name,
+			From:  a.Field(i).Interface(),
+			To:    b.Field(i).Interface(),
+		})
+	}
+	return changes
+}
+
+// restore puts the content of a revision back on the recipe. Steps whose text
+// is still the same keep their IDs, so their images are not lost.
+func restore(recipe *entities.Recipe, content entities.RevisionContent) {
+	current := make(map[string][]uint)
+	for _, step := range recipe.Steps {
+		current[step.Text] = append(current[step.Text], step.ID)
+	}
+	steps := make([]entities.Step, 0, len(content.Steps))
+	for _, step := range content.Steps {
+		if ids := current[step.Text]; len(ids) > 0 {
+			step.ID = ids[0]
+			current[step.Text] = ids[1:]
+		}
+		steps = append(steps, step)
+	}
+
+	recipe.RecipeName = content.RecipeName
+	recipe.Description = content.Description
+	recipe.Ingredients = content.Ingredients
+	recipe.Difficulty = content.Difficulty
+	recipe.Servings = content.Servings
+	recipe.PrepTime = content.PrepTime
+	recipe.CookTime = content.CookTime
+	recipe.RestTime = content.RestTime
+	recipe.Steps = steps
+	recipe.Tags = content.Tags
+	recipe.AddedLabels = content.AddedLabels
+	recipe.RemovedLabels = content.RemovedLabels
+}
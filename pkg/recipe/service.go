@@ -1,8 +1,14 @@
 package recipe
 
 import (
+	"fmt"
 	"github.com/biezhi/gorm-paginator/pagination"
+	"github.com/rithikjain/SocialRecipe/pkg"
 	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"github.com/rithikjain/SocialRecipe/pkg/mailer"
+	"github.com/rithikjain/SocialRecipe/pkg/nutrition"
+	"log"
+	"time"
 )
 
 type Service interface {
@@ -14,42 +20,167 @@ type Service interface {
 
 	FindRecipeByID(recipeID uint) (*entities.Recipe, error)
 
+	FindVisibleRecipe(viewerID, recipeID uint) (*entities.Recipe, error)
+
+	ScaleRecipe(recipe *entities.Recipe, servings int, units string) (*entities.Recipe, error)
+
 	LikeRecipe(userID, recipeID uint) error
 
 	UnlikeRecipe(userID, recipeID uint) error
 
-	ShowUsersWhoLiked(recipeID uint, pageNo int) (*pagination.Paginator, error)
+	ShowUsersWhoLiked(viewerID, recipeID uint, pageNo int) (*pagination.Paginator, error)
 
-	GetAllRecipesOfUser(userID uint, pageNo int) (*pagination.Paginator, error)
+	GetAllRecipesOfUser(userID, viewerID uint, pageNo int) (*pagination.Paginator, error)
 
 	ShowUsersFavRecipes(userID uint, pageNo int) (*pagination.Paginator, error)
 
-	ShowUserFeed(userID uint, pageNo int) (*pagination.Paginator, error)
+	ShowUserFeed(userID uint, filter *Filter, pageNo int) (*pagination.Paginator, error)
+
+	ShowAllLatestRecipes(userID uint, filter *Filter, pageNo int) (*pagination.Paginator, error)
 
-	ShowAllLatestRecipes(pageNo int) (*pagination.Paginator, error)
+	SearchRecipes(viewerID uint, filter *Filter, pageNo int) (*pagination.Paginator, error)
 
-	SearchRecipes(query string, pageNo int) (*pagination.Paginator, error)
+	GetPopularTags(kind string, limit int) ([]PopularTag, error)
+
+	ShowRecipesByTag(viewerID uint, kind, slug string, pageNo int) (*pagination.Paginator, error)
 
 	DeleteRecipe(recipeID uint) error
 
 	HasUserLiked(userID, recipeID uint) (bool, error)
+
+	MigrateLegacyIngredients() (int, error)
+
+	MigrateLegacyProcedures() (int, error)
+
+	RecalculateNutrition() (int, error)
+
+	RecalculateDietaryLabels() (int, error)
+
+	GetSteps(recipeID uint) ([]entities.Step, error)
+
+	AddStep(step *entities.Step) ([]entities.Step, error)
+
+	DeleteStep(recipeID, stepID uint) ([]entities.Step, error)
+
+	ReorderSteps(recipeID uint, stepIDs []uint) ([]entities.Step, error)
+
+	GetImages(recipeID uint) ([]entities.RecipeImage, error)
+
+	AddImage(image *entities.RecipeImage) ([]entities.RecipeImage, error)
+
+	UpdateImage(image *entities.RecipeImage) ([]entities.RecipeImage, error)
+
+	ReplaceCoverImage(image *entities.RecipeImage) ([]entities.RecipeImage, error)
+
+	DeleteImage(recipeID, imageID uint) ([]entities.RecipeImage, error)
+
+	ReorderImages(recipeID uint, imageIDs []uint) ([]entities.RecipeImage, error)
+
+	MigrateCoverImages() (int, error)
+
+	GetRevisions(recipeID uint, pageNo int) (*pagination.Paginator, error)
+
+	GetRevision(recipeID uint, number int) (*entities.RecipeRevision, error)
+
+	DiffRevisions(recipeID uint, from, to int) ([]Change, error)
+
+	RestoreRevision(recipeID uint, number int) (*entities.Recipe, error)
+
+	MigrateRevisions() (int, error)
+
+	ForkRecipe(userID, recipeID uint) (*entities.Recipe, error)
+
+	ShowForks(viewerID, recipeID uint, pageNo int) (*pagination.Paginator, error)
+
+	PublishScheduledRecipes() (int, error)
+
+	MigrateVisibility() (int, error)
 }
 
 type service struct {
-	repo Repository
+	repo   Repository
+	mailer mailer.Mailer
 }
 
-func NewService(r Repository) Service {
+func NewService(r Repository, m mailer.Mailer) Service {
 	return &service{
-		repo: r,
+		repo:   r,
+		mailer: m,
 	}
 }
 
 func (s *service) CreateRecipe(recipe *entities.Recipe) (*entities.Recipe, error) {
+	if recipe.Servings < 0 || recipe.Servings > maxServings {
+		return nil, pkg.ErrServings
+	}
+	if err := normalizeTimes(recipe); err != nil {
+		return nil, err
+	}
+	ingredients, err := NormalizeIngredients(recipe.Ingredients)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := NormalizeSteps(recipe.Steps)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := NormalizeTags(recipe.Tags)
+	if err != nil {
+		return nil, err
+	}
+	recipe.Ingredients = ingredients
+	recipe.Steps = steps
+	if recipe.AddedLabels, err = nutrition.NormalizeLabels(recipe.AddedLabels); err != nil {
+		return nil, err
+	}
+	if recipe.RemovedLabels, err = nutrition.NormalizeLabels(recipe.RemovedLabels); err != nil {
+		return nil, err
+	}
+	recipe.Tags = tags
+	if err := normalizeImages(recipe); err != nil {
+		return nil, err
+	}
+	if err := normalizeVisibility(recipe, time.Now()); err != nil {
+		return nil, err
+	}
+	nutrition.Calculate(recipe)
+	nutrition.Classify(recipe)
 	return s.repo.CreateRecipe(recipe)
 }
 
 func (s *service) UpdateRecipe(recipe *entities.Recipe) (*entities.Recipe, error) {
+	if recipe.Servings < 0 || recipe.Servings > maxServings {
+		return nil, pkg.ErrServings
+	}
+	if err := normalizeTimes(recipe); err != nil {
+		return nil, err
+	}
+	ingredients, err := NormalizeIngredients(recipe.Ingredients)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := NormalizeSteps(recipe.Steps)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := NormalizeTags(recipe.Tags)
+	if err != nil {
+		return nil, err
+	}
+	recipe.Ingredients = ingredients
+	recipe.Steps = steps
+	if recipe.AddedLabels, err = nutrition.NormalizeLabels(recipe.AddedLabels); err != nil {
+		return nil, err
+	}
+	if recipe.RemovedLabels, err = nutrition.NormalizeLabels(recipe.RemovedLabels); err != nil {
+		return nil, err
+	}
+	recipe.Tags = tags
+	if err := normalizeVisibility(recipe, time.Now()); err != nil {
+		return nil, err
+	}
+	nutrition.Calculate(recipe)
+	nutrition.Classify(recipe)
 	return s.repo.UpdateRecipe(recipe)
 }
 
@@ -61,36 +192,103 @@ func (s *service) FindRecipeByID(recipeID uint) (*entities.Recipe, error) {
 	return s.repo.FindRecipeByID(recipeID)
 }
 
+func (s *service) FindVisibleRecipe(viewerID, recipeID uint) (*entities.Recipe, error) {
+	return s.repo.FindVisibleRecipe(viewerID, recipeID)
+}
+
+func (s *service) ScaleRecipe(recipe *entities.Recipe, servings int, units string) (*entities.Recipe, error) {
+	return ScaleRecipe(recipe, servings, units)
+}
+
 func (s *service) LikeRecipe(userID, recipeID uint) error {
+	if _, err := s.repo.FindVisibleRecipe(userID, recipeID); err != nil {
+		return err
+	}
 	return s.repo.LikeRecipe(userID, recipeID)
 }
 
 func (s *service) UnlikeRecipe(userID, recipeID uint) error {
+	if _, err := s.repo.FindVisibleRecipe(userID, recipeID); err != nil {
+		return err
+	}
 	return s.repo.UnlikeRecipe(userID, recipeID)
 }
 
-func (s *service) ShowUsersWhoLiked(recipeID uint, pageNo int) (*pagination.Paginator, error) {
+func (s *service) ShowUsersWhoLiked(viewerID, recipeID uint, pageNo int) (*pagination.Paginator, error) {
+	if _, err := s.repo.FindVisibleRecipe(viewerID, recipeID); err != nil {
+		return nil, err
+	}
 	return s.repo.GetUsersWhoLiked(recipeID, pageNo)
 }
 
-func (s *service) GetAllRecipesOfUser(userID uint, pageNo int) (*pagination.Paginator, error) {
-	return s.repo.GetAllRecipesOfUser(userID, pageNo)
+func (s *service) GetAllRecipesOfUser(userID, viewerID uint, pageNo int) (*pagination.Paginator, error) {
+	return s.repo.GetAllRecipesOfUser(userID, viewerID, pageNo)
 }
 
 func (s *service) ShowUsersFavRecipes(userID uint, pageNo int) (*pagination.Paginator, error) {
 	return s.repo.GetUsersFavRecipes(userID, pageNo)
 }
 
-func (s *service) ShowUserFeed(userID uint, pageNo int) (*pagination.Paginator, error) {
-	return s.repo.GetUserFeed(userID, pageNo)
+// ShowUserFeed lists the recipes of the users the user follows that fit the
+// dietary preferences of the user.
+func (s *service) ShowUserFeed(userID uint, filter *Filter, pageNo int) (*pagination.Paginator, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	user, err := s.repo.FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	filter.Labels = user.DietaryPreferences
+	return s.repo.GetUserFeed(userID, filter, pageNo)
 }
 
-func (s *service) ShowAllLatestRecipes(pageNo int) (*pagination.Paginator, error) {
-	return s.repo.GetAllLatestRecipes(pageNo)
+// ShowAllLatestRecipes lists the newest recipes that fit the dietary
+// preferences of the user.
+func (s *service) ShowAllLatestRecipes(userID uint, filter *Filter, pageNo int) (*pagination.Paginator, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	user, err := s.repo.FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	filter.Labels = user.DietaryPreferences
+	return s.repo.GetAllLatestRecipes(userID, filter, pageNo)
 }
 
-func (s *service) SearchRecipes(query string, pageNo int) (*pagination.Paginator, error) {
-	return s.repo.SearchRecipes(query, pageNo)
+func (s *service) SearchRecipes(viewerID uint, filter *Filter, pageNo int) (*pagination.Paginator, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	tags, err := NormalizeTags(filter.Tags)
+	if err != nil {
+		return nil, err
+	}
+	filter.Tags = tags
+	return s.repo.SearchRecipes(viewerID, filter, pageNo)
+}
+
+// GetPopularTags returns the tags carried by the most recipes, of one kind or
+// of all kinds when kind is empty.
+func (s *service) GetPopularTags(kind string, limit int) ([]PopularTag, error) {
+	if kind != "" && !validTagKind(kind) {
+		return nil, pkg.ErrTags
+	}
+	if limit <= 0 || limit > maxPopularTags {
+		limit = maxPopularTags
+	}
+	return s.repo.GetPopularTags(kind, limit)
+}
+
+func (s *service) ShowRecipesByTag(viewerID uint, kind, slug string, pageNo int) (*pagination.Paginator, error) {
+	if kind == "" {
+		kind = entities.TagFree
+	}
+	if !validTagKind(kind) {
+		return nil, pkg.ErrTags
+	}
+	return s.repo.GetRecipesByTag(viewerID, kind, Slugify(slug), pageNo)
 }
 
 func (s *service) DeleteRecipe(recipeID uint) error {
@@ -98,5 +296,357 @@ func (s *service) DeleteRecipe(recipeID uint) error {
 }
 
 func (s *service) HasUserLiked(userID, recipeID uint) (bool, error) {
+	if _, err := s.repo.FindVisibleRecipe(userID, recipeID); err != nil {
+		return false, err
+	}
 	return s.repo.HasUserLiked(userID, recipeID)
 }
+
+// MigrateLegacyIngredients parses the free text ingredients recipes were
+// created with before ingredients were structured. It returns how many
+// recipes were converted.
+func (s *service) MigrateLegacyIngredients() (int, error) {
+	converted := 0
+	for {
+		recipes, err := s.repo.GetRecipesWithLegacyIngredients(100)
+		if err != nil {
+			return converted, err
+		}
+		if len(recipes) == 0 {
+			return converted, nil
+		}
+		for i := range recipes {
+			ingredients, err := NormalizeIngredients(firstIngredients(ParseIngredients(recipes[i].LegacyIngredients)))
+			if err != nil {
+				// Every recipe has to be converted or it would come up again
+				// on every start, so the lines are kept as they were written
+				log.Printf("recipe %d: keeping ingredients unparsed: %s", recipes[i].ID, err.Error())
+				ingredients, err = NormalizeIngredients(firstIngredients(RawIngredients(recipes[i].LegacyIngredients)))
+				if err != nil {
+					return converted, err
+				}
+			}
+			if err := s.repo.ConvertLegacyIngredients(&recipes[i], ingredients); err != nil {
+				return converted, err
+			}
+			converted++
+		}
+	}
+}
+
+func firstIngredients(ingredients []entities.Ingredient) []entities.Ingredient {
+	if len(ingredients) > maxIngredients {
+		return ingredients[:maxIngredients]
+	}
+	return ingredients
+}
+
+// MigrateLegacyProcedures splits the free text procedure of older recipes into
+// steps. It returns how many recipes were converted.
+func (s *service) MigrateLegacyProcedures() (int, error) {
+	converted := 0
+	for {
+		recipes, err := s.repo.GetRecipesWithLegacyProcedure(100)
+		if err != nil {
+			return converted, err
+		}
+		if len(recipes) == 0 {
+			return converted, nil
+		}
+		for i := range recipes {
+			steps := ParseSteps(recipes[i].LegacyProcedure)
+			if len(steps) > maxSteps {
+				steps = steps[:maxSteps]
+			}
+			if err := s.repo.ConvertLegacyProcedure(&recipes[i], steps); err != nil {
+				return converted, err
+			}
+			converted++
+		}
+	}
+}
+
+// RecalculateNutrition estimates the nutrition of recipes that have none yet
+// or got theirs from an older food table. It returns how many recipes were
+// updated.
+func (s *service) RecalculateNutrition() (int, error) {
+	updated := 0
+	for {
+		recipes, err := s.repo.GetRecipesWithStaleNutrition(nutrition.Version, 100)
+		if err != nil {
+			return updated, err
+		}
+		if len(recipes) == 0 {
+			return updated, nil
+		}
+		for i := range recipes {
+			nutrition.Calculate(&recipes[i])
+			if err := s.repo.SaveNutrition(&recipes[i]); err != nil {
+				return updated, err
+			}
+			updated++
+		}
+	}
+}
+
+// RecalculateDietaryLabels labels recipes that were labelled with another rule
+// table. It returns how many recipes were updated.
+func (s *service) RecalculateDietaryLabels() (int, error) {
+	updated := 0
+	for {
+		recipes, err := s.repo.GetRecipesWithStaleDietaryLabels(nutrition.DietaryVersion(), 100)
+		if err != nil {
+			return updated, err
+		}
+		if len(recipes) == 0 {
+			return updated, nil
+		}
+		for i := range recipes {
+			nutrition.Classify(&recipes[i])
+			if err := s.repo.SaveDietaryLabels(&recipes[i]); err != nil {
+				return updated, err
+			}
+			updated++
+		}
+	}
+}
+
+func (s *service) GetSteps(recipeID uint) ([]entities.Step, error) {
+	return s.repo.GetSteps(recipeID)
+}
+
+// AddStep inserts a step at step.Position and returns the steps of the recipe
+// afterwards.
+func (s *service) AddStep(step *entities.Step) ([]entities.Step, error) {
+	normalized, err := NormalizeStep(*step)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := s.repo.GetSteps(step.RecipeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) >= maxSteps {
+		return nil, pkg.ErrSteps
+	}
+
+	step.ID = 0
+	step.Text = normalized.Text
+	if err := s.repo.InsertStep(step); err != nil {
+		return nil, err
+	}
+	return s.repo.GetSteps(step.RecipeID)
+}
+
+func (s *service) DeleteStep(recipeID, stepID uint) ([]entities.Step, error) {
+	if err := s.repo.DeleteStep(recipeID, stepID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetSteps(recipeID)
+}
+
+func (s *service) ReorderSteps(recipeID uint, stepIDs []uint) ([]entities.Step, error) {
+	if err := s.repo.ReorderSteps(recipeID, stepIDs); err != nil {
+		return nil, err
+	}
+	return s.repo.GetSteps(recipeID)
+}
+
+func (s *service) GetImages(recipeID uint) ([]entities.RecipeImage, error) {
+	return s.repo.GetImages(recipeID)
+}
+
+// AddImage inserts an image at image.Position and returns the images of the
+// recipe afterwards.
+func (s *service) AddImage(image *entities.RecipeImage) ([]entities.RecipeImage, error) {
+	altText, err := NormalizeAltText(image.AltText)
+	if err != nil {
+		return nil, err
+	}
+	image.ID = 0
+	image.AltText = altText
+	if err := s.repo.InsertImage(image); err != nil {
+		return nil, err
+	}
+	return s.repo.GetImages(image.RecipeID)
+}
+
+func (s *service) UpdateImage(image *entities.RecipeImage) ([]entities.RecipeImage, error) {
+	altText, err := NormalizeAltText(image.AltText)
+	if err != nil {
+		return nil, err
+	}
+	image.AltText = altText
+	if err := s.repo.UpdateImage(image); err != nil {
+		return nil, err
+	}
+	return s.repo.GetImages(image.RecipeID)
+}
+
+// ReplaceCoverImage puts a new file in place of the cover, which is how
+// clients that predate galleries change the image of a recipe.
+func (s *service) ReplaceCoverImage(image *entities.RecipeImage) ([]entities.RecipeImage, error) {
+	altText, err := NormalizeAltText(image.AltText)
+	if err != nil {
+		return nil, err
+	}
+	image.ID = 0
+	image.AltText = altText
+	if err := s.repo.ReplaceCoverImage(image); err != nil {
+		return nil, err
+	}
+	return s.repo.GetImages(image.RecipeID)
+}
+
+func (s *service) DeleteImage(recipeID, imageID uint) ([]entities.RecipeImage, error) {
+	if err := s.repo.DeleteImage(recipeID, imageID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetImages(recipeID)
+}
+
+func (s *service) ReorderImages(recipeID uint, imageIDs []uint) ([]entities.RecipeImage, error) {
+	if err := s.repo.ReorderImages(recipeID, imageIDs); err != nil {
+		return nil, err
+	}
+	return s.repo.GetImages(recipeID)
+}
+
+// MigrateCoverImages starts the gallery of recipes from before galleries with
+// the image stored on the recipe. It returns how many recipes were converted.
+func (s *service) MigrateCoverImages() (int, error) {
+	converted := 0
+	for {
+		recipes, err := s.repo.GetRecipesWithoutImages(100)
+		if err != nil {
+			return converted, err
+		}
+		if len(recipes) == 0 {
+			return converted, nil
+		}
+		for _, recipe := range recipes {
+			image := &entities.RecipeImage{
+				RecipeID:    recipe.ID,
+				ImgUrl:      recipe.ImgUrl,
+				ImgPublicId: recipe.ImgPublicId,
+				ImgVariants: recipe.ImgVariants,
+				Cover:       true,
+			}
+			if err := s.repo.InsertImage(image); err != nil {
+				return converted, err
+			}
+			converted++
+		}
+	}
+}
+
+func (s *service) GetRevisions(recipeID uint, pageNo int) (*pagination.Paginator, error) {
+	return s.repo.GetRevisions(recipeID, pageNo)
+}
+
+func (s *service) GetRevision(recipeID uint, number int) (*entities.RecipeRevision, error) {
+	return s.repo.GetRevision(recipeID, number)
+}
+
+// DiffRevisions lists what changed from revision from to revision to.
+func (s *service) DiffRevisions(recipeID uint, from, to int) ([]Change, error) {
+	a, err := s.repo.GetRevision(recipeID, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.repo.GetRevision(recipeID, to)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(a.Content, b.Content), nil
+}
+
+// RestoreRevision saves the content of an older revision as the recipe, which
+// makes it the newest revision.
+func (s *service) RestoreRevision(recipeID uint, number int) (*entities.Recipe, error) {
+	revision, err := s.repo.GetRevision(recipeID, number)
+	if err != nil {
+		return nil, err
+	}
+	recipe, err := s.repo.FindRecipeByID(recipeID)
+	if err != nil {
+		return nil, err
+	}
+	restore(recipe, revision.Content)
+	return s.UpdateRecipe(recipe)
+}
+
+// MigrateRevisions keeps recipes from before revisions as their first
+// revision. It returns how many recipes were converted.
+func (s *service) MigrateRevisions() (int, error) {
+	converted := 0
+	for {
+		recipes, err := s.repo.GetRecipesWithoutRevisions(100)
+		if err != nil {
+			return converted, err
+		}
+		if len(recipes) == 0 {
+			return converted, nil
+		}
+		for _, recipe := range recipes {
+			if err := s.repo.SaveRevision(recipe.ID); err != nil {
+				return converted, err
+			}
+			converted++
+		}
+	}
+}
+
+// ForkRecipe copies someone else's recipe into the account of the user and
+// lets the author of the original know by mail.
+func (s *service) ForkRecipe(userID, recipeID uint) (*entities.Recipe, error) {
+	original, err := s.repo.FindVisibleRecipe(userID, recipeID)
+	if err != nil {
+		return nil, err
+	}
+	if original.UserID == userID {
+		return nil, pkg.ErrForkOwn
+	}
+	user, err := s.repo.FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	recipe := fork(original, user)
+	if err := normalizeVisibility(recipe, time.Now()); err != nil {
+		return nil, err
+	}
+	recipe, err = s.repo.CreateRecipe(recipe)
+	if err != nil {
+		return nil, err
+	}
+
+	author, err := s.repo.FindUserByID(original.UserID)
+	if err != nil {
+		return recipe, nil
+	}
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"@%s adapted your recipe \"%s\" on Cooks Social. "+
+		"Their version credits you as the original author.\n", author.Name, user.Username, original.RecipeName)
+	go func() {
+		if err := s.mailer.Send(author.Email, "Your recipe was adapted", body); err != nil {
+			log.Println("fork mail failed:", err)
+		}
+	}()
+	return recipe, nil
+}
+
+func (s *service) ShowForks(viewerID, recipeID uint, pageNo int) (*pagination.Paginator, error) {
+	return s.repo.GetForks(viewerID, recipeID, pageNo)
+}
+
+// PublishScheduledRecipes publishes the recipes whose publish time has come.
+// It returns how many recipes were published.
+func (s *service) PublishScheduledRecipes() (int, error) {
+	return s.repo.PublishScheduledRecipes(time.Now())
+}
+
+// MigrateVisibility dates the recipes from before visibility as published
+// when they were created. It returns how many recipes were converted.
+func (s *service) MigrateVisibility() (int, error) {
+	return s.repo.SetPublishedDates()
+}
@@ -0,0 +1,107 @@
+package recipe
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxSteps       = 100
+	maxStepSeconds = 7 * 24 * 60 * 60
+)
+
+var (
+	// "Step 3:", "3." or "3)" in front of a step
+	stepNumberRe = regexp.MustCompile(`^(?i:step\s*)?\d+\s*[.):]\s+`)
+
+	// The first time span mentioned in a step, e.g. "20 minutes" or
+	// "1-2 hrs", which takes the upper bound
+	durationRe = regexp.MustCompile(`(?i)\b(\d+)(?:\s*(?:-|–|to)\s*(\d+))?\s*(hours?|hrs?|minutes?|mins?|seconds?|secs?)\b`)
+)
+
+// NormalizeSteps checks steps sent by a client and returns clean copies
+// numbered in the order they were given. The IDs are kept so images of
+// existing steps can be carried over.
+func NormalizeSteps(steps []entities.Step) ([]entities.Step, error) {
+	if len(steps) > maxSteps {
+		return nil, pkg.ErrSteps
+	}
+	normalized := make([]entities.Step, 0, len(steps))
+	for i, step := range steps {
+		step, err := NormalizeStep(step)
+		if err != nil {
+			return nil, err
+		}
+		step.Position = i
+		normalized = append(normalized, step)
+	}
+	return normalized, nil
+}
+
+func NormalizeStep(step entities.Step) (entities.Step, error) {
+	text := strings.TrimSpace(step.Text)
+	if text == "" || step.DurationSeconds < 0 || step.DurationSeconds > maxStepSeconds {
+		return entities.Step{}, pkg.ErrSteps
+	}
+	return entities.Step{
+		Model:           gorm.Model{ID: step.ID},
+		Text:            text,
+		DurationSeconds: step.DurationSeconds,
+	}, nil
+}
+
+// ParseSteps splits a free text procedure into steps. Paragraphs are steps
+// when the text has blank lines between them, otherwise every line is one.
+// Step numbers are dropped and the first time span a step mentions becomes
+// its timer.
+func ParseSteps(text string) []entities.Step {
+	text = strings.TrimSpace(strings.Replace(text, "\r\n", "\n", -1))
+	var chunks []string
+	if strings.Contains(text, "\n\n") {
+		for _, paragraph := range strings.Split(text, "\n\n") {
+			chunks = append(chunks, strings.Join(strings.Fields(paragraph), " "))
+		}
+	} else {
+		chunks = strings.Split(text, "\n")
+	}
+
+	var steps []entities.Step
+	for _, chunk := range chunks {
+		chunk = strings.TrimSpace(stepNumberRe.ReplaceAllString(trimBullet(strings.TrimSpace(chunk)), ""))
+		if chunk == "" {
+			continue
+		}
+		steps = append(steps, entities.Step{
+			Position:        len(steps),
+			Text:            chunk,
+			DurationSeconds: durationIn(chunk),
+		})
+	}
+	return steps
+}
+
+func durationIn(text string) int {
+	match := durationRe.FindStringSubmatch(text)
+	if match == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(match[1])
+	if match[2] != "" {
+		n, _ = strconv.Atoi(match[2])
+	}
+	unit := strings.ToLower(match[3])
+	switch {
+	case strings.HasPrefix(unit, "h"):
+		n *= 60 * 60
+	case strings.HasPrefix(unit, "m"):
+		n *= 60
+	}
+	if n > maxStepSeconds {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,139 @@
+package recipe
+
+import (
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"strings"
+	"unicode"
+)
+
+const (
+	maxTags        = 20
+	maxTagLength   = 30
+	maxPopularTags = 100
+)
+
+// PopularTag is a tag with the number of recipes carrying it
+type PopularTag struct {
+	Kind    string `json:"kind"`
+	Slug    string `json:"slug"`
+	Name    string `json:"name"`
+	Recipes int    `json:"recipes"`
+}
+
+// The curated vocabularies, free tags are anything else authors come up with
+var vocabularies = map[string][]string{
+	entities.TagCuisine: {
+		"American", "British", "Caribbean", "Chinese", "Ethiopian", "French",
+		"German", "Greek", "Indian", "Italian", "Japanese", "Korean",
+		"Lebanese", "Mediterranean", "Mexican", "Middle Eastern", "Moroccan",
+		"Spanish", "Thai", "Turkish", "Vietnamese",
+	},
+	entities.TagCourse: {
+		"Appetizer", "Soup", "Salad", "Main", "Side", "Dessert", "Bread",
+		"Sauce", "Drink",
+	},
+	entities.TagMealType: {
+		"Breakfast", "Brunch", "Lunch", "Dinner", "Snack",
+	},
+}
+
+// Vocabularies returns the curated tags by kind.
+func Vocabularies() map[string][]entities.Tag {
+	tags := make(map[string][]entities.Tag, len(vocabularies))
+	for kind, names := range vocabularies {
+		for _, name := range names {
+			tags[kind] = append(tags[kind], entities.Tag{Kind: kind, Slug: Slugify(name), Name: name})
+		}
+	}
+	return tags
+}
+
+// NormalizeTags checks tags sent by a client and returns clean copies without
+// duplicates. Tags without a kind are free tags, the others have to be in
+// their vocabulary and get its spelling.
+func NormalizeTags(tags []entities.Tag) ([]entities.Tag, error) {
+	normalized := make([]entities.Tag, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		kind := strings.ToLower(strings.TrimSpace(tag.Kind))
+		if kind == "" {
+			kind = entities.TagFree
+		}
+		name := strings.Join(strings.Fields(tag.Name), " ")
+		if name == "" {
+			name = tag.Slug
+		}
+		slug := Slugify(name)
+		if slug == "" || len(name) > maxTagLength {
+			return nil, pkg.ErrTags
+		}
+		if kind != entities.TagFree {
+			name = vocabularyName(kind, slug)
+			if name == "" {
+				return nil, pkg.ErrTags
+			}
+		}
+		if seen[kind+":"+slug] {
+			continue
+		}
+		seen[kind+":"+slug] = true
+		normalized = append(normalized, entities.Tag{Kind: kind, Slug: slug, Name: name})
+	}
+	if len(normalized) > maxTags {
+		return nil, pkg.ErrTags
+	}
+	return normalized, nil
+}
+
+// ParseTags reads comma separated tags like "cuisine:italian, weeknight",
+// where tags without a kind are free tags.
+func ParseTags(text string) []entities.Tag {
+	var tags []entities.Tag
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		tag := entities.Tag{Name: part}
+		if i := strings.Index(part, ":"); i > 0 {
+			tag.Kind, tag.Name = part[:i], part[i+1:]
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// Slugify turns a tag name into its lower case, dashed form, e.g. "Middle
+// Eastern" into "middle-eastern".
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+func vocabularyName(kind, slug string) string {
+	for _, name := range vocabularies[kind] {
+		if Slugify(name) == slug {
+			return name
+		}
+	}
+	return ""
+}
+
+func validTagKind(kind string) bool {
+	_, curated := vocabularies[kind]
+	return curated || kind == entities.TagFree
+}
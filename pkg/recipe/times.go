@@ -0,0 +1,21 @@
+package recipe
+
+import (
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+)
+
+// Marinating and proving can take a few days, nothing takes longer
+const maxRecipeTime = entities.Duration(7 * 24 * 60 * 60)
+
+// normalizeTimes checks the prep, cook and rest times of a recipe and adds
+// them up to its total time.
+func normalizeTimes(recipe *entities.Recipe) error {
+	for _, d := range []entities.Duration{recipe.PrepTime, recipe.CookTime, recipe.RestTime} {
+		if d < 0 || d > maxRecipeTime {
+			return pkg.ErrDuration
+		}
+	}
+	recipe.TotalTime = recipe.PrepTime + recipe.CookTime + recipe.RestTime
+	return nil
+}
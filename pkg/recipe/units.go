@@ -0,0 +1,143 @@
+package recipe
+
+import (
+	"fmt"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"github.com/rithikjain/SocialRecipe/pkg/nutrition"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	UnitsMetric = "metric"
+	UnitsUS     = "us"
+
+	maxServings = 100
+)
+
+// Units used the same way in both systems, which are left alone
+var sharedUnits = map[string]bool{
+	"tsp":   true,
+	"tbsp":  true,
+	"pinch": true,
+	"dash":  true,
+}
+
+// Oven and frying temperatures mentioned in steps, e.g. "180°C" or
+// "350 degrees F"
+var temperatureRe = regexp.MustCompile(`(?i)(\d{2,3})\s*(?:°|º|degrees?)\s*(c|f|celsius|fahrenheit)\b`)
+
+// ScaleRecipe returns a copy of the recipe for the given number of servings,
+// with quantities and temperatures converted to units. Zero servings or empty
+// units leave that part as the author wrote it.
+func ScaleRecipe(recipe *entities.Recipe, servings int, units string) (*entities.Recipe, error) {
+	if servings < 0 || servings > maxServings {
+		return nil, pkg.ErrServings
+	}
+	if units != "" && units != UnitsMetric && units != UnitsUS {
+		return nil, pkg.ErrUnits
+	}
+	factor := 1.0
+	if servings > 0 && servings != recipe.Servings {
+		if recipe.Servings == 0 {
+			return nil, pkg.ErrServings
+		}
+		factor = float64(servings) / float64(recipe.Servings)
+	}
+
+	scaled := *recipe
+	if servings > 0 {
+		scaled.Servings = servings
+	}
+	scaled.Nutrition = nutrition.Scale(recipe.Nutrition, factor)
+	scaled.Ingredients = make([]entities.Ingredient, len(recipe.Ingredients))
+	for i, ingredient := range recipe.Ingredients {
+		if ingredient.Quantity != nil {
+			quantity, unit := convertUnit(*ingredient.Quantity*factor, ingredient.Unit, units)
+			quantity = roundQuantity(quantity)
+			ingredient.Quantity = &quantity
+			ingredient.Unit = unit
+		}
+		scaled.Ingredients[i] = ingredient
+	}
+	scaled.Steps = make([]entities.Step, len(recipe.Steps))
+	for i, step := range recipe.Steps {
+		step.Text = convertTemperatures(step.Text, units)
+		scaled.Steps[i] = step
+	}
+	return &scaled, nil
+}
+
+// convertUnit expresses quantity in the unit of the system that reads best
+// for its size.
+func convertUnit(quantity float64, unit, units string) (float64, string) {
+	if sharedUnits[unit] {
+		return quantity, unit
+	}
+	if grams, ok := nutrition.GramsPer[unit]; ok {
+		grams *= quantity
+		switch {
+		case units == UnitsMetric && grams >= 1000:
+			return grams / 1000, "kg"
+		case units == UnitsMetric && (unit == "oz" || unit == "lb" || unit == "kg"):
+			return grams, "g"
+		case units == UnitsUS && grams >= nutrition.GramsPer["lb"]:
+			return grams / nutrition.GramsPer["lb"], "lb"
+		case units == UnitsUS:
+			return grams / nutrition.GramsPer["oz"], "oz"
+		}
+		return quantity, unit
+	}
+	if millilitres, ok := nutrition.MillilitresPer[unit]; ok {
+		millilitres *= quantity
+		switch {
+		case units == UnitsMetric && millilitres >= 1000:
+			return millilitres / 1000, "l"
+		case units == UnitsMetric:
+			return millilitres, "ml"
+		case units == UnitsUS && millilitres < 15:
+			return millilitres / nutrition.MillilitresPer["tsp"], "tsp"
+		case units == UnitsUS && millilitres < 60:
+			return millilitres / nutrition.MillilitresPer["tbsp"], "tbsp"
+		case units == UnitsUS:
+			return millilitres / nutrition.MillilitresPer["cup"], "cup"
+		}
+	}
+	return quantity, unit
+}
+
+func convertTemperatures(text, units string) string {
+	if units == "" {
+		return text
+	}
+	return temperatureRe.ReplaceAllStringFunc(text, func(match string) string {
+		parts := temperatureRe.FindStringSubmatch(match)
+		degrees, _ := strconv.ParseFloat(parts[1], 64)
+		celsius := strings.HasPrefix(strings.ToLower(parts[2]), "c")
+		switch {
+		case celsius && units == UnitsUS:
+			return fmt.Sprintf("%.0f°F", roundTo(degrees*9/5+32, 5))
+		case !celsius && units == UnitsMetric:
+			return fmt.Sprintf("%.0f°C", roundTo((degrees-32)*5/9, 5))
+		}
+		return match
+	})
+}
+
+// Scaled quantities are rounded to what a cook can measure
+func roundQuantity(quantity float64) float64 {
+	switch {
+	case quantity >= 100:
+		return roundTo(quantity, 5)
+	case quantity >= 10:
+		return math.Round(quantity)
+	}
+	return math.Round(quantity*100) / 100
+}
+
+func roundTo(value, step float64) float64 {
+	return math.Round(value/step) * step
+}
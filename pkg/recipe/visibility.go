@@ -0,0 +1,33 @@
+package recipe
+
+import (
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"time"
+)
+
+// normalizeVisibility checks who may see the recipe and when. Recipes are
+// public unless told otherwise, only ones shown to others can be scheduled
+// and a publish time that has passed means publishing now.
+func normalizeVisibility(recipe *entities.Recipe, now time.Time) error {
+	switch recipe.Visibility {
+	case "":
+		recipe.Visibility = entities.VisibilityPublic
+	case entities.VisibilityDraft, entities.VisibilityPrivate, entities.VisibilityFollowers, entities.VisibilityPublic:
+	default:
+		return pkg.ErrVisibility
+	}
+	shown := recipe.Visibility == entities.VisibilityFollowers || recipe.Visibility == entities.VisibilityPublic
+	if recipe.PublishAt != nil {
+		if !shown {
+			return pkg.ErrVisibility
+		}
+		if !recipe.PublishAt.After(now) {
+			recipe.PublishAt = nil
+		}
+	}
+	if shown && recipe.PublishAt == nil && recipe.PublishedAt == nil {
+		recipe.PublishedAt = &now
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type cloudinaryStore struct {
+	uploadURL    string
+	uploadPreset string
+	deleteURL    string
+}
+
+// NewCloudinaryStore returns an ImageStore that does unsigned uploads with
+// the upload preset. Deleting goes through deleteURL, which carries the
+// credentials of the admin API.
+func NewCloudinaryStore(uploadURL, uploadPreset, deleteURL string) ImageStore {
+	return &cloudinaryStore{
+		uploadURL:    uploadURL,
+		uploadPreset: uploadPreset,
+		deleteURL:    deleteURL,
+	}
+}
+
+func (s *cloudinaryStore) Upload(data []byte, contentType string) (string, string, error) {
+	form := url.Values{}
+	form.Add("file", dataURI(data, contentType))
+	form.Add("upload_preset", s.uploadPreset)
+
+	response, err := http.PostForm(s.uploadURL, form)
+	if err != nil {
+		return "", "", err
+	}
+	defer response.Body.Close()
+
+	var resJson map[string]interface{}
+	if err := json.NewDecoder(response.Body).Decode(&resJson); err != nil || response.StatusCode != http.StatusOK {
+		return "", "", ErrUpload
+	}
+	imgUrl, _ := resJson["secure_url"].(string)
+	publicID, _ := resJson["public_id"].(string)
+	return imgUrl, publicID, nil
+}
+
+func (s *cloudinaryStore) Delete(publicID string) error {
+	req, err := http.NewRequest("DELETE", s.deleteURL, nil)
+	if err != nil {
+		return err
+	}
+	q := req.URL.Query()
+	q.Add("public_ids", publicID)
+	req.URL.RawQuery = q.Encode()
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return ErrDelete
+	}
+	return nil
+}
+
+// Cloudinary takes uploads as data URIs, anything it does not know is sent
+// as png
+func dataURI(data []byte, mime string) string {
+	switch mime {
+	case "image/gif", "image/jpeg", "image/pjpeg", "image/png", "image/tiff":
+	default:
+		mime = "image/png"
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data))
+}
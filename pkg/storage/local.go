@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type localStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalStore returns an ImageStore that writes images to dir, for local
+// development. The store serves them itself, baseURL is where it is mounted.
+func NewLocalStore(dir, baseURL string) ImageStore {
+	if dir == "" {
+		dir = "images"
+	}
+	return &localStore{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (s *localStore) Upload(data []byte, contentType string) (string, string, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", "", err
+	}
+	name, err := newName(contentType)
+	if err != nil {
+		return "", "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(s.dir, name), data, 0644); err != nil {
+		return "", "", err
+	}
+	return s.baseURL + "/" + name, name, nil
+}
+
+// Delete removes the image, one that is gone already counts as deleted.
+func (s *localStore) Delete(name string) error {
+	err := os.Remove(filepath.Join(s.dir, filepath.Base(name)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP serves the images by their name, without directory listings.
+func (s *localStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := filepath.Base(r.URL.Path)
+	if name == "." || name == "/" || strings.HasPrefix(name, ".") {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, filepath.Join(s.dir, name))
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"github.com/rithikjain/SocialRecipe/pkg/imaging"
+	"strings"
+)
+
+// Stored is an image stored along with its scaled down copies. ID holds the
+// ids of all of its files separated by spaces, which is what gets saved as
+// the public id of the image.
+type Stored struct {
+	URL      string
+	Variants entities.ImageVariants
+	ID       string
+}
+
+// Put stores a processed image and its copies. When one of them cannot be
+// stored, the ones stored already are deleted again.
+func Put(store ImageStore, processed *imaging.Processed) (*Stored, error) {
+	var ids []string
+	put := func(file imaging.File) (string, error) {
+		url, id, err := store.Upload(file.Data, file.ContentType)
+		if err != nil {
+			return "", err
+		}
+		ids = append(ids, id)
+		return url, nil
+	}
+
+	stored := &Stored{}
+	var err error
+	if stored.URL, err = put(processed.Original); err == nil {
+		stored.Variants.Thumbnail, err = put(processed.Thumbnail)
+	}
+	urls := map[string]string{}
+	for _, width := range imaging.Widths {
+		if err != nil {
+			break
+		}
+		urls[width.Name] = stored.URL
+		if file, ok := processed.Variants[width.Name]; ok {
+			urls[width.Name], err = put(file)
+		}
+	}
+	if err != nil {
+		_ = Remove(store, strings.Join(ids, " "))
+		return nil, err
+	}
+	stored.Variants.Small = urls["small"]
+	stored.Variants.Medium = urls["medium"]
+	stored.Variants.Large = urls["large"]
+	stored.ID = strings.Join(ids, " ")
+	return stored, nil
+}
+
+// Remove deletes every file of a stored image. Images stored before they had
+// copies have a single id, which works the same.
+func Remove(store ImageStore, id string) error {
+	for _, fileID := range strings.Fields(id) {
+		if err := store.Delete(fileID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
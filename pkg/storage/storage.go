@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+)
+
+var (
+	ErrUpload = errors.New("Error: Storing the image failed")
+	ErrDelete = errors.New("Error: Deleting the image failed")
+)
+
+// ImageStore keeps uploaded images somewhere they can be served from. Upload
+// returns the public url of the image and the id to delete it by.
+type ImageStore interface {
+	Upload(data []byte, contentType string) (url, id string, err error)
+
+	Delete(id string) error
+}
+
+// FromEnv picks the image store configured by the imageStore env variable,
+// "cloudinary" unless it says "local" or "s3". Local images are linked under
+// /images of the API unless imageUrl says otherwise. Images are deleted by the
+// store that is configured when they are deleted, so switching stores leaves
+// the images of the old one behind.
+func FromEnv() ImageStore {
+	switch os.Getenv("imageStore") {
+	case "local":
+		baseURL := os.Getenv("imageUrl")
+		if baseURL == "" {
+			baseURL = os.Getenv("apiUrl") + "/images"
+		}
+		return NewLocalStore(os.Getenv("imageDir"), baseURL)
+	case "s3":
+		return NewS3Store(
+			os.Getenv("s3Endpoint"),
+			os.Getenv("s3Region"),
+			os.Getenv("s3Bucket"),
+			os.Getenv("s3AccessKey"),
+			os.Getenv("s3SecretKey"),
+			os.Getenv("s3PublicUrl"),
+		)
+	}
+	return NewCloudinaryStore(os.Getenv("cloudinaryUrl"), os.Getenv("uploadPreset"), os.Getenv("cloudinaryDeleteUrl"))
+}
+
+// Extensions of the image types browsers show, other files are stored as
+// they come without one
+var extensions = map[string]string{
+	"image/gif":  ".gif",
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// newName makes a random file name for an image of the content type.
+func newName(contentType string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b) + extensions[contentType], nil
+}
@@ -3,8 +3,10 @@ package user
 import (
 	"github.com/biezhi/gorm-paginator/pagination"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 	"github.com/rithikjain/SocialRecipe/pkg"
 	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"time"
 )
 
 type Repository interface {
@@ -36,7 +38,53 @@ type Repository interface {
 
 	UpdateUserBio(userID uint, bio string) error
 
+	UpdateDietaryPreferences(userID uint, preferences []string) error
+
 	HasUserFavorited(userID, recipeID uint) (bool, error)
+
+	CreatePasswordResetToken(token *entities.PasswordResetToken) error
+
+	FindPasswordResetToken(tokenHash string) (*entities.PasswordResetToken, error)
+
+	ResetPassword(token *entities.PasswordResetToken, passwordHash string) (bool, error)
+
+	MarkVerificationSent(userID uint, notBefore time.Time) (bool, error)
+
+	SetVerified(userID uint, email string) (bool, error)
+
+	ListUsers(query string, pageNo int) (*pagination.Paginator, error)
+
+	SetSuspended(userID uint, suspended bool) error
+
+	SetRole(email, role string) error
+
+	DeleteAccount(userID uint) ([]string, error)
+
+	GetPendingImageDeletions(maxAttempts, limit int) ([]entities.ImageDeletion, error)
+
+	FinishImageDeletion(deletion *entities.ImageDeletion, err error) error
+
+	IsImageInUse(publicID string) (bool, error)
+
+	EnableTwoFactor(userID uint, codeHashes []string) error
+
+	DisableTwoFactor(userID uint) error
+
+	UseTOTPStep(userID uint, step int64) (bool, error)
+
+	UseRecoveryCode(userID uint, codeHash string) (bool, error)
+
+	FindLoginThrottles(keys ...string) ([]entities.LoginThrottle, error)
+
+	RecordLoginFailure(key string, resetAfter time.Duration, lockFor func(failures int) time.Duration) error
+
+	ClearLoginThrottle(key string) error
+
+	FindByIdentity(provider, subject string) (*entities.User, error)
+
+	CreateIdentity(identity *entities.UserIdentity) error
+
+	RegisterWithIdentity(user *entities.User, identity *entities.UserIdentity) (*entities.User, error)
 }
 
 type repo struct {
@@ -262,6 +310,14 @@ func (r *repo) UpdateUserBio(userID uint, bio string) error {
 	return nil
 }
 
+func (r *repo) UpdateDietaryPreferences(userID uint, preferences []string) error {
+	err := r.DB.Model(&entities.User{}).Where("id = ?", userID).Update("dietary_preferences", pq.StringArray(preferences)).Error
+	if err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
 func (r *repo) HasUserFavorited(userID, recipeID uint) (bool, error) {
 	ans := r.DB.Where("user_id = ? and recipe_id = ?", userID, recipeID).Find(&entities.FavoriteRecipe{})
 	if ans.Error != nil {
@@ -273,3 +329,492 @@ func (r *repo) HasUserFavorited(userID, recipeID uint) (bool, error) {
 	}
 	return true, nil
 }
+
+func (r *repo) CreatePasswordResetToken(token *entities.PasswordResetToken) error {
+	if err := r.DB.Create(token).Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) FindPasswordResetToken(tokenHash string) (*entities.PasswordResetToken, error) {
+	token := &entities.PasswordResetToken{}
+	result := r.DB.Where("token_hash = ?", tokenHash).First(token)
+	if result.RecordNotFound() {
+		return nil, pkg.ErrNotFound
+	}
+	if result.Error != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return token, nil
+}
+
+// ResetPassword uses up token and stores the new password hash in one
+// transaction. Every other outstanding reset token of the user is used up as
+// well. It reports false if token had already been used.
+func (r *repo) ResetPassword(token *entities.PasswordResetToken, passwordHash string) (bool, error) {
+	tx := r.DB.Begin()
+	result := tx.Model(&entities.PasswordResetToken{}).
+		Where("id = ? and used = ?", token.ID, false).
+		Update("used", true)
+	if result.Error != nil {
+		tx.Rollback()
+		return false, pkg.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+	err := tx.Model(&entities.PasswordResetToken{}).
+		Where("user_id = ? and used = ?", token.UserID, false).
+		Update("used", true).Error
+	if err != nil {
+		tx.Rollback()
+		return false, pkg.ErrDatabase
+	}
+	err = tx.Model(&entities.User{}).Where("id = ?", token.UserID).Update("password", passwordHash).Error
+	if err != nil {
+		tx.Rollback()
+		return false, pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, pkg.ErrDatabase
+	}
+	return true, nil
+}
+
+// MarkVerificationSent records that a verification mail is being sent now,
+// unless the previous one was sent after notBefore. It reports whether a mail
+// may be sent.
+func (r *repo) MarkVerificationSent(userID uint, notBefore time.Time) (bool, error) {
+	result := r.DB.Model(&entities.User{}).
+		Where("id = ? and (verification_sent_at is null or verification_sent_at < ?)", userID, notBefore).
+		Update("verification_sent_at", time.Now())
+	if result.Error != nil {
+		return false, pkg.ErrDatabase
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *repo) SetVerified(userID uint, email string) (bool, error) {
+	result := r.DB.Model(&entities.User{}).Where("id = ? and email = ?", userID, email).Update("verified", true)
+	if result.Error != nil {
+		return false, pkg.ErrDatabase
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *repo) ListUsers(query string, pageNo int) (*pagination.Paginator, error) {
+	var users []entities.User
+	stmt := r.DB
+	if query != "" {
+		stmt = stmt.Where("lower(username) LIKE ? or lower(name) LIKE ? or lower(email) LIKE ?", "%"+query+"%", "%"+query+"%", "%"+query+"%")
+	}
+	page := pagination.Paging(&pagination.Param{
+		DB:      stmt,
+		Page:    pageNo,
+		Limit:   20,
+		OrderBy: []string{"created_at desc"},
+	}, &users)
+	for i := range users {
+		users[i].Password = ""
+	}
+	return page, nil
+}
+
+func (r *repo) SetSuspended(userID uint, suspended bool) error {
+	result := r.DB.Model(&entities.User{}).Where("id = ?", userID).Update("suspended", suspended)
+	if result.Error != nil {
+		return pkg.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return pkg.ErrNotFound
+	}
+	return nil
+}
+
+func (r *repo) SetRole(email, role string) error {
+	result := r.DB.Model(&entities.User{}).Where("email = ?", email).Update("role", role)
+	if result.Error != nil {
+		return pkg.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return pkg.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteAccount removes the user and everything that belongs to them in one
+// transaction, keeping the counters on other users and recipes in sync. The
+// images of the user are queued for deletion from the image host, the paths
+// of their export archives are returned to be removed once it is committed.
+func (r *repo) DeleteAccount(userID uint) ([]string, error) {
+	user, err := r.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := r.DB.Begin()
+	archives, err := deleteAccount(tx, user)
+	if err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return archives, nil
+}
+
+func deleteAccount(tx *gorm.DB, user *entities.User) ([]string, error) {
+	var recipes []entities.Recipe
+	if err := tx.Where("user_id = ?", user.ID).Find(&recipes).Error; err != nil {
+		return nil, err
+	}
+	publicIDs := []string{user.ProfileImgPublicID}
+	var recipeIDs []uint
+	for _, recipe := range recipes {
+		recipeIDs = append(recipeIDs, recipe.ID)
+		publicIDs = append(publicIDs, recipe.ImgPublicId)
+	}
+
+	// The recipes of this user with their ingredients, steps, images, tags and
+	// revisions, and the likes and favourites other users gave them
+	if len(recipeIDs) > 0 {
+		if err := tx.Where("recipe_id in (?)", recipeIDs).Unscoped().Delete(&entities.LikeDetail{}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("recipe_id in (?)", recipeIDs).Unscoped().Delete(&entities.FavoriteRecipe{}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("recipe_id in (?)", recipeIDs).Unscoped().Delete(&entities.Ingredient{}).Error; err != nil {
+			return nil, err
+		}
+		var steps []entities.Step
+		if err := tx.Where("recipe_id in (?) and img_public_id <> ''", recipeIDs).Find(&steps).Error; err != nil {
+			return nil, err
+		}
+		for _, step := range steps {
+			publicIDs = append(publicIDs, step.ImgPublicId)
+		}
+		if err := tx.Where("recipe_id in (?)", recipeIDs).Unscoped().Delete(&entities.Step{}).Error; err != nil {
+			return nil, err
+		}
+		var images []entities.RecipeImage
+		if err := tx.Where("recipe_id in (?)", recipeIDs).Find(&images).Error; err != nil {
+			return nil, err
+		}
+		for _, image := range images {
+			publicIDs = append(publicIDs, image.ImgPublicId)
+		}
+		if err := tx.Where("recipe_id in (?)", recipeIDs).Unscoped().Delete(&entities.RecipeImage{}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("recipe_id in (?)", recipeIDs).Unscoped().Delete(&entities.RecipeRevision{}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Exec("DELETE FROM recipe_tags WHERE recipe_id in (?)", recipeIDs).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("id in (?)", recipeIDs).Unscoped().Delete(&entities.Recipe{}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Likes this user gave to other recipes
+	var likes []entities.LikeDetail
+	if err := tx.Where("user_id = ?", user.ID).Find(&likes).Error; err != nil {
+		return nil, err
+	}
+	var likedRecipeIDs []uint
+	for _, like := range likes {
+		likedRecipeIDs = append(likedRecipeIDs, like.RecipeID)
+	}
+	if len(likedRecipeIDs) > 0 {
+		err := tx.Model(&entities.Recipe{}).Where("id in (?) and likes > 0", likedRecipeIDs).
+			UpdateColumn("likes", gorm.Expr("likes - 1")).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Where("user_id = ?", user.ID).Unscoped().Delete(&entities.LikeDetail{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Unscoped().Delete(&entities.FavoriteRecipe{}).Error; err != nil {
+		return nil, err
+	}
+
+	// Users this user follows lose a follower
+	var followings []entities.Following
+	if err := tx.Where("user_id = ?", user.ID).Find(&followings).Error; err != nil {
+		return nil, err
+	}
+	var followingIDs []uint
+	for _, following := range followings {
+		followingIDs = append(followingIDs, following.OthersUserID)
+	}
+	if len(followingIDs) > 0 {
+		err := tx.Model(&entities.User{}).Where("id in (?) and followers_count > 0", followingIDs).
+			UpdateColumn("followers_count", gorm.Expr("followers_count - 1")).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Users who follow this user lose a following
+	var followers []entities.Follower
+	if err := tx.Where("user_id = ?", user.ID).Find(&followers).Error; err != nil {
+		return nil, err
+	}
+	var followerIDs []uint
+	for _, follower := range followers {
+		followerIDs = append(followerIDs, follower.OthersUserID)
+	}
+	if len(followerIDs) > 0 {
+		err := tx.Model(&entities.User{}).Where("id in (?) and following_count > 0", followerIDs).
+			UpdateColumn("following_count", gorm.Expr("following_count - 1")).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Where("user_id = ? or others_user_id = ?", user.ID, user.ID).Unscoped().Delete(&entities.Following{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ? or others_user_id = ?", user.ID, user.ID).Unscoped().Delete(&entities.Follower{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Unscoped().Delete(&entities.RefreshToken{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Unscoped().Delete(&entities.PasswordResetToken{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Unscoped().Delete(&entities.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Unscoped().Delete(&entities.UserIdentity{}).Error; err != nil {
+		return nil, err
+	}
+
+	// The cover of a recipe is both on the recipe and in its images
+	queued := make(map[string]bool, len(publicIDs))
+	for _, publicID := range publicIDs {
+		if publicID == "" || queued[publicID] {
+			continue
+		}
+		queued[publicID] = true
+		if err := tx.Create(&entities.ImageDeletion{PublicID: publicID}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Data exports are the whole account in one file
+	var exports []entities.DataExport
+	if err := tx.Where("user_id = ?", user.ID).Find(&exports).Error; err != nil {
+		return nil, err
+	}
+	var archives []string
+	for _, export := range exports {
+		if export.FilePath != "" {
+			archives = append(archives, export.FilePath)
+		}
+	}
+	if err := tx.Where("user_id = ?", user.ID).Unscoped().Delete(&entities.DataExport{}).Error; err != nil {
+		return nil, err
+	}
+
+	return archives, tx.Unscoped().Delete(user).Error
+}
+
+func (r *repo) GetPendingImageDeletions(maxAttempts, limit int) ([]entities.ImageDeletion, error) {
+	var deletions []entities.ImageDeletion
+	err := r.DB.Where("attempts < ?", maxAttempts).Order("updated_at asc").Limit(limit).Find(&deletions).Error
+	if err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return deletions, nil
+}
+
+// FinishImageDeletion drops deletion from the queue if it succeeded, otherwise
+// the failure is recorded so it is retried later.
+func (r *repo) FinishImageDeletion(deletion *entities.ImageDeletion, err error) error {
+	if err == nil {
+		if err := r.DB.Unscoped().Delete(deletion).Error; err != nil {
+			return pkg.ErrDatabase
+		}
+		return nil
+	}
+	deletion.Attempts += 1
+	deletion.LastError = err.Error()
+	if err := r.DB.Save(deletion).Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+// IsImageInUse tells whether a recipe, one of its images or steps still uses
+// the image, which forks do after the original let go of it.
+func (r *repo) IsImageInUse(publicID string) (bool, error) {
+	for _, model := range []interface{}{&entities.Recipe{}, &entities.RecipeImage{}, &entities.Step{}} {
+		count := 0
+		if err := r.DB.Model(model).Where("img_public_id = ?", publicID).Count(&count).Error; err != nil {
+			return false, pkg.ErrDatabase
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// EnableTwoFactor turns on two factor authentication with the secret already
+// stored on the user and replaces their recovery codes.
+func (r *repo) EnableTwoFactor(userID uint, codeHashes []string) error {
+	tx := r.DB.Begin()
+	if err := tx.Where("user_id = ?", userID).Unscoped().Delete(&entities.RecoveryCode{}).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	for _, hash := range codeHashes {
+		if err := tx.Create(&entities.RecoveryCode{UserID: userID, CodeHash: hash}).Error; err != nil {
+			tx.Rollback()
+			return pkg.ErrDatabase
+		}
+	}
+	if err := tx.Model(&entities.User{}).Where("id = ?", userID).Update("two_factor_enabled", true).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) DisableTwoFactor(userID uint) error {
+	tx := r.DB.Begin()
+	if err := tx.Where("user_id = ?", userID).Unscoped().Delete(&entities.RecoveryCode{}).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	err := tx.Model(&entities.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"two_factor_enabled": false,
+		"totp_secret":        "",
+		"totp_last_step":     0,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+// UseTOTPStep records step as used so the same code cannot be replayed. It
+// reports false if this or a later step was already used.
+func (r *repo) UseTOTPStep(userID uint, step int64) (bool, error) {
+	result := r.DB.Model(&entities.User{}).Where("id = ? and totp_last_step < ?", userID, step).Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, pkg.ErrDatabase
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *repo) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result := r.DB.Model(&entities.RecoveryCode{}).
+		Where("user_id = ? and code_hash = ? and used = ?", userID, codeHash, false).
+		Update("used", true)
+	if result.Error != nil {
+		return false, pkg.ErrDatabase
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *repo) FindLoginThrottles(keys ...string) ([]entities.LoginThrottle, error) {
+	var throttles []entities.LoginThrottle
+	if err := r.DB.Where("key in (?)", keys).Find(&throttles).Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return throttles, nil
+}
+
+// RecordLoginFailure counts a failed login for key and locks it for as long as
+// lockFor says, given the number of failures so far. The count starts over if
+// the last failure is older than resetAfter.
+func (r *repo) RecordLoginFailure(key string, resetAfter time.Duration, lockFor func(failures int) time.Duration) error {
+	// Make sure the row exists so it can be locked, ignoring the conflict if a
+	// concurrent request created it first
+	r.DB.Exec("INSERT INTO login_throttles (key, failures, created_at, updated_at) VALUES (?, 0, now(), now()) ON CONFLICT (key) DO NOTHING", key)
+
+	tx := r.DB.Begin()
+	throttle := &entities.LoginThrottle{}
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("key = ?", key).First(throttle).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	now := time.Now()
+	if now.Sub(throttle.LastFailureAt) > resetAfter {
+		throttle.Failures = 0
+	}
+	throttle.Failures += 1
+	throttle.LastFailureAt = now
+	if lock := lockFor(throttle.Failures); lock > 0 {
+		throttle.LockedUntil = now.Add(lock)
+	}
+	if err := tx.Save(throttle).Error; err != nil {
+		tx.Rollback()
+		return pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) ClearLoginThrottle(key string) error {
+	if err := r.DB.Where("key = ?", key).Unscoped().Delete(&entities.LoginThrottle{}).Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+func (r *repo) FindByIdentity(provider, subject string) (*entities.User, error) {
+	identity := &entities.UserIdentity{}
+	result := r.DB.Where("provider = ? and subject = ?", provider, subject).First(identity)
+	if result.RecordNotFound() {
+		return nil, pkg.ErrNotFound
+	}
+	if result.Error != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return r.FindByID(identity.UserID)
+}
+
+func (r *repo) CreateIdentity(identity *entities.UserIdentity) error {
+	if err := r.DB.Create(identity).Error; err != nil {
+		return pkg.ErrDatabase
+	}
+	return nil
+}
+
+// RegisterWithIdentity creates the user and links the identity to it in one
+// transaction, so no account is left behind that nobody can sign in to.
+func (r *repo) RegisterWithIdentity(user *entities.User, identity *entities.UserIdentity) (*entities.User, error) {
+	tx := r.DB.Begin()
+	if err := tx.Create(user).Error; err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	identity.UserID = user.ID
+	if err := tx.Create(identity).Error; err != nil {
+		tx.Rollback()
+		return nil, pkg.ErrDatabase
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, pkg.ErrDatabase
+	}
+	return user, nil
+}
@@ -1,11 +1,31 @@
 package user
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"github.com/biezhi/gorm-paginator/pagination"
 	"github.com/rithikjain/SocialRecipe/pkg"
 	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"github.com/rithikjain/SocialRecipe/pkg/mailer"
+	"github.com/rithikjain/SocialRecipe/pkg/nutrition"
+	"github.com/rithikjain/SocialRecipe/pkg/oidc"
+	"github.com/rithikjain/SocialRecipe/pkg/totp"
 	"golang.org/x/crypto/bcrypt"
+	"log"
+	"net/url"
+	"os"
 	"strings"
+	"time"
+)
+
+const (
+	passwordResetTTL      = time.Hour
+	imageDeletionAttempts = 10
+
+	totpIssuer        = "Cooks Social"
+	recoveryCodeCount = 10
 )
 
 type Service interface {
@@ -13,7 +33,7 @@ type Service interface {
 
 	UpdateUser(user *entities.User) (*entities.User, error)
 
-	Login(email, password string) (*entities.User, error)
+	Login(email, password, ip string) (*entities.User, error)
 
 	DoesEmailExist(email string) (bool, error)
 
@@ -37,18 +57,60 @@ type Service interface {
 
 	UpdateUserBio(userID uint, bio string) error
 
+	UpdateDietaryPreferences(userID uint, preferences []string) ([]string, error)
+
 	HasUserFavorited(userID, recipeID uint) (bool, error)
 
+	RequestPasswordReset(email string) error
+
+	ResetPassword(token, password string) (*entities.User, error)
+
+	SendVerification(user *entities.User) error
+
+	VerifyEmail(token string) error
+
+	ChangePassword(userID uint, currentPassword, newPassword string) (*entities.User, error)
+
+	ChangeEmail(userID uint, password, email string) (*entities.User, error)
+
+	ListUsers(query string, pageNo int) (*pagination.Paginator, error)
+
+	SuspendUser(userID uint) error
+
+	UnsuspendUser(userID uint) error
+
+	ResetProfileImage(userID uint) (*entities.User, error)
+
+	PromoteToAdmin(email string) error
+
+	DeleteAccount(userID uint, password string) error
+
+	ProcessImageDeletions(destroy func(publicID string) error) error
+
+	SetupTwoFactor(userID uint) (string, string, error)
+
+	EnableTwoFactor(userID uint, code string) ([]string, error)
+
+	DisableTwoFactor(userID uint, password, code string) error
+
+	VerifySecondFactor(userID uint, code, ip string) (*entities.User, error)
+
+	UnlockLogin(userID uint, ip string) error
+
+	LoginWithIdentity(identity *oidc.Identity) (*entities.User, error)
+
 	GetRepo() Repository
 }
 
 type service struct {
-	repo Repository
+	repo   Repository
+	mailer mailer.Mailer
 }
 
-func NewService(r Repository) Service {
+func NewService(r Repository, m mailer.Mailer) Service {
 	return &service{
-		repo: r,
+		repo:   r,
+		mailer: m,
 	}
 }
 
@@ -83,23 +145,80 @@ func (s *service) Register(user *entities.User) (*entities.User, error) {
 		return nil, err
 	}
 	user.Password = pass
-	return s.repo.Register(user)
+	user, err = s.repo.Register(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SendVerification(user); err != nil {
+		log.Println("verification mail failed:", err)
+	}
+	return user, nil
 }
 
 func (s *service) UpdateUser(user *entities.User) (*entities.User, error) {
 	return s.repo.UpdateUser(user)
 }
 
-func (s *service) Login(email, password string) (*entities.User, error) {
-	user := &entities.User{}
+// Login checks the credentials of a user. Failed attempts are counted per
+// email and per IP, and once too many pile up further attempts are refused
+// for a while, whether the password is right or not. Users with two factor
+// authentication are only logged in once VerifySecondFactor checks out too.
+func (s *service) Login(email, password, ip string) (*entities.User, error) {
+	if err := s.checkLoginThrottles(email, ip); err != nil {
+		return nil, err
+	}
+
 	user, err := s.repo.FindByEmail(email)
-	if err != nil {
+	if err != nil && err != pkg.ErrNotFound {
 		return nil, err
 	}
-	if CheckPasswordHash(password, user.Password) {
-		return user, nil
+	if err == pkg.ErrNotFound || !CheckPasswordHash(password, user.Password) {
+		s.recordLoginFailure(email, ip)
+		return nil, pkg.ErrNotFound
+	}
+
+	if user.Suspended {
+		return nil, pkg.ErrSuspended
+	}
+	if !user.TwoFactorEnabled {
+		if err := s.repo.ClearLoginThrottle(emailThrottleKey(email)); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// checkLoginThrottles refuses logins for the email or IP while they are locked
+func (s *service) checkLoginThrottles(email, ip string) error {
+	keys := []string{emailThrottleKey(email)}
+	if ip != "" {
+		keys = append(keys, ipThrottleKey(ip))
+	}
+	throttles, err := s.repo.FindLoginThrottles(keys...)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, throttle := range throttles {
+		if now.Before(throttle.LockedUntil) {
+			return pkg.ErrLocked
+		}
+	}
+	return nil
+}
+
+func (s *service) recordLoginFailure(email, ip string) {
+	err := s.repo.RecordLoginFailure(emailThrottleKey(email), failureWindow, backoff(accountFreeAttempts))
+	if err != nil {
+		log.Println("recording login failure failed:", err)
+	}
+	if ip == "" {
+		return
+	}
+	err = s.repo.RecordLoginFailure(ipThrottleKey(ip), failureWindow, backoff(ipFreeAttempts))
+	if err != nil {
+		log.Println("recording login failure failed:", err)
 	}
-	return nil, pkg.ErrNotFound
 }
 
 func (s *service) GetUserByID(id uint) (*entities.User, error) {
@@ -138,10 +257,496 @@ func (s *service) UpdateUserBio(userID uint, bio string) error {
 	return s.repo.UpdateUserBio(userID, bio)
 }
 
+// UpdateDietaryPreferences stores the dietary labels the recipes in the feed
+// and on explore have to carry for the user.
+func (s *service) UpdateDietaryPreferences(userID uint, preferences []string) ([]string, error) {
+	normalized, err := nutrition.NormalizeLabels(preferences)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateDietaryPreferences(userID, normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
 func (s *service) HasUserFavorited(userID, recipeID uint) (bool, error) {
 	return s.repo.HasUserFavorited(userID, recipeID)
 }
 
+// RequestPasswordReset mails a single use reset link to the owner of email.
+// Unknown emails are not reported so the endpoint cannot be used to find out
+// who has an account.
+func (s *service) RequestPasswordReset(email string) error {
+	user, err := s.repo.FindByEmail(email)
+	if err == pkg.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	raw, err := randomToken()
+	if err != nil {
+		return err
+	}
+	err = s.repo.CreatePasswordResetToken(&entities.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := os.Getenv("appUrl") + "/reset-password?token=" + raw
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Someone asked to reset the password of your Cooks Social account. "+
+		"If it was you, open the link below within the next hour to choose a new password.\n\n"+
+		"%s\n\n"+
+		"If you did not ask for this you can ignore this mail.\n", user.Name, link)
+	go func() {
+		if err := s.mailer.Send(user.Email, "Reset your password", body); err != nil {
+			log.Println("password reset mail failed:", err)
+		}
+	}()
+	return nil
+}
+
+func (s *service) ResetPassword(token, password string) (*entities.User, error) {
+	resetToken, err := s.repo.FindPasswordResetToken(hashToken(token))
+	if err == pkg.ErrNotFound {
+		return nil, pkg.ErrResetToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resetToken.Used || time.Now().After(resetToken.ExpiresAt) {
+		return nil, pkg.ErrResetToken
+	}
+
+	user, err := s.repo.FindByID(resetToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = password
+	if ok, err := Validate(user); !ok {
+		return nil, err
+	}
+	pass, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.repo.ResetPassword(resetToken, pass)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, pkg.ErrResetToken
+	}
+	user.Password = pass
+	return user, nil
+}
+
+// SendVerification mails the user a link that confirms their email. Mails are
+// throttled so the resend endpoint cannot be used to spam an inbox.
+func (s *service) SendVerification(user *entities.User) error {
+	if user.Verified {
+		return nil
+	}
+	ok, err := s.repo.MarkVerificationSent(user.ID, time.Now().Add(-verificationResendInterval))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return pkg.ErrTooMany
+	}
+
+	token := NewVerificationToken(user, time.Now().Add(verificationTTL))
+	link := os.Getenv("apiUrl") + "/api/v1/user/verify?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Welcome to Cooks Social! Please confirm your email by opening the link below.\n\n"+
+		"%s\n", user.Name, link)
+	go func() {
+		if err := s.mailer.Send(user.Email, "Confirm your email", body); err != nil {
+			log.Println("verification mail failed:", err)
+		}
+	}()
+	return nil
+}
+
+func (s *service) VerifyEmail(token string) error {
+	userID, email, err := ParseVerificationToken(token)
+	if err != nil {
+		return err
+	}
+	ok, err := s.repo.SetVerified(userID, email)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return pkg.ErrVerifyToken
+	}
+	return nil
+}
+
+func (s *service) ChangePassword(userID uint, currentPassword, newPassword string) (*entities.User, error) {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !CheckPasswordHash(currentPassword, user.Password) {
+		return nil, pkg.ErrWrongPass
+	}
+
+	candidate := *user
+	candidate.Password = newPassword
+	if ok, err := Validate(&candidate); !ok {
+		return nil, err
+	}
+	pass, err := HashPassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = pass
+	return s.repo.UpdateUser(user)
+}
+
+// ChangeEmail moves the account to a new email, which has to be verified again.
+func (s *service) ChangeEmail(userID uint, password, email string) (*entities.User, error) {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !CheckPasswordHash(password, user.Password) {
+		return nil, pkg.ErrWrongPass
+	}
+
+	candidate := *user
+	candidate.Email = email
+	candidate.Password = password
+	if ok, err := Validate(&candidate); !ok {
+		return nil, err
+	}
+	exist, err := s.repo.DoesEmailExist(email)
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		return nil, pkg.ErrExists
+	}
+
+	user.Email = email
+	user.Verified = false
+	user.VerificationSentAt = nil
+	user, err = s.repo.UpdateUser(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SendVerification(user); err != nil {
+		log.Println("verification mail failed:", err)
+	}
+	return user, nil
+}
+
+func (s *service) ListUsers(query string, pageNo int) (*pagination.Paginator, error) {
+	return s.repo.ListUsers(query, pageNo)
+}
+
+func (s *service) SuspendUser(userID uint) error {
+	return s.repo.SetSuspended(userID, true)
+}
+
+func (s *service) UnsuspendUser(userID uint) error {
+	return s.repo.SetSuspended(userID, false)
+}
+
+func (s *service) ResetProfileImage(userID uint) (*entities.User, error) {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	user.ProfileImgUrl = entities.DefaultProfileImgUrl
+	user.ProfileImgPublicID = ""
+	user.ProfileImgVariants = entities.ImageVariants{}
+	return s.repo.UpdateUser(user)
+}
+
+func (s *service) PromoteToAdmin(email string) error {
+	return s.repo.SetRole(email, entities.RoleAdmin)
+}
+
+func (s *service) DeleteAccount(userID uint, password string) error {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if !CheckPasswordHash(password, user.Password) {
+		return pkg.ErrWrongPass
+	}
+	archives, err := s.repo.DeleteAccount(userID)
+	if err != nil {
+		return err
+	}
+	for _, path := range archives {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("removing export archive %s failed: %s", path, err.Error())
+		}
+	}
+	return nil
+}
+
+// ProcessImageDeletions works through the queue of images left behind by
+// deleted accounts and recipes. Images a fork still uses are kept, images that
+// keep failing are given up on after a while.
+func (s *service) ProcessImageDeletions(destroy func(publicID string) error) error {
+	deletions, err := s.repo.GetPendingImageDeletions(imageDeletionAttempts, 50)
+	if err != nil {
+		return err
+	}
+	for i := range deletions {
+		inUse, err := s.repo.IsImageInUse(deletions[i].PublicID)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			if err := s.repo.FinishImageDeletion(&deletions[i], nil); err != nil {
+				return err
+			}
+			continue
+		}
+		err = destroy(deletions[i].PublicID)
+		if err != nil {
+			log.Printf("deleting image %s failed: %s", deletions[i].PublicID, err.Error())
+		}
+		if err := s.repo.FinishImageDeletion(&deletions[i], err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetupTwoFactor stores a new TOTP secret for the user and returns it along
+// with its otpauth URI. It only takes effect once confirmed with a code.
+func (s *service) SetupTwoFactor(userID uint) (string, string, error) {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TwoFactorEnabled {
+		return "", "", pkg.ErrTwoFactorOn
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	if _, err := s.repo.UpdateUser(user); err != nil {
+		return "", "", err
+	}
+	return secret, totp.URI(totpIssuer, user.Email, secret), nil
+}
+
+// EnableTwoFactor confirms the secret from SetupTwoFactor with a code and
+// returns a fresh set of recovery codes, which are only ever shown this once.
+func (s *service) EnableTwoFactor(userID uint, code string) ([]string, error) {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, pkg.ErrTwoFactorOn
+	}
+	if user.TOTPSecret == "" {
+		return nil, pkg.ErrTwoFactorOff
+	}
+	if err := s.checkTOTP(user, code); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hashToken(codes[i])
+	}
+	if err := s.repo.EnableTwoFactor(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *service) DisableTwoFactor(userID uint, password, code string) error {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled {
+		return pkg.ErrTwoFactorOff
+	}
+	if !CheckPasswordHash(password, user.Password) {
+		return pkg.ErrWrongPass
+	}
+	if err := s.checkSecondFactor(user, code); err != nil {
+		return err
+	}
+	return s.repo.DisableTwoFactor(userID)
+}
+
+// VerifySecondFactor finishes the login of a user with two factor
+// authentication, accepting either a current TOTP code or an unused recovery
+// code of the user.
+func (s *service) VerifySecondFactor(userID uint, code, ip string) (*entities.User, error) {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TwoFactorEnabled {
+		return nil, pkg.ErrTwoFactorOff
+	}
+	if user.Suspended {
+		return nil, pkg.ErrSuspended
+	}
+	// Wrong codes count against the account like wrong passwords, the login
+	// only succeeded once the code is right
+	if err := s.checkLoginThrottles(user.Email, ip); err != nil {
+		return nil, err
+	}
+	if err := s.checkSecondFactor(user, code); err != nil {
+		if err == pkg.ErrTwoFactor {
+			s.recordLoginFailure(user.Email, ip)
+		}
+		return nil, err
+	}
+	if err := s.repo.ClearLoginThrottle(emailThrottleKey(user.Email)); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// checkSecondFactor accepts a TOTP code or an unused recovery code
+func (s *service) checkSecondFactor(user *entities.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) != len("xxxxx-xxxxx") {
+		return s.checkTOTP(user, code)
+	}
+	ok, err := s.repo.UseRecoveryCode(user.ID, hashToken(strings.ToLower(code)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return pkg.ErrTwoFactor
+	}
+	return nil
+}
+
+func (s *service) checkTOTP(user *entities.User, code string) error {
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return pkg.ErrTwoFactor
+	}
+	ok, err := s.repo.UseTOTPStep(user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return pkg.ErrTwoFactor
+	}
+	return nil
+}
+
+// UnlockLogin lifts the login lockout of a user and, when given, of an IP.
+func (s *service) UnlockLogin(userID uint, ip string) error {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.ClearLoginThrottle(emailThrottleKey(user.Email)); err != nil {
+		return err
+	}
+	if ip != "" {
+		return s.repo.ClearLoginThrottle(ipThrottleKey(ip))
+	}
+	return nil
+}
+
+// LoginWithIdentity signs in the user an external identity belongs to. An
+// identity seen for the first time is linked to the account with the same
+// email, or gets a new account with a generated username.
+func (s *service) LoginWithIdentity(identity *oidc.Identity) (*entities.User, error) {
+	user, err := s.repo.FindByIdentity(identity.Provider, identity.Subject)
+	if err == pkg.ErrNotFound {
+		user, err = s.linkIdentity(identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Suspended {
+		return nil, pkg.ErrSuspended
+	}
+	return user, nil
+}
+
+func (s *service) linkIdentity(identity *oidc.Identity) (*entities.User, error) {
+	// Accounts are matched by email, so it has to be one the provider checked
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, pkg.ErrNoEmail
+	}
+	link := &entities.UserIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	user, err := s.repo.FindByEmail(identity.Email)
+	if err == nil {
+		// Anyone could have registered an unverified account with this email
+		// and would keep its password after the owner signed in
+		if !user.Verified {
+			return nil, pkg.ErrLinkAccount
+		}
+		link.UserID = user.ID
+		if err := s.repo.CreateIdentity(link); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if err != pkg.ErrNotFound {
+		return nil, err
+	}
+
+	username, err := s.generateUsername(identity)
+	if err != nil {
+		return nil, err
+	}
+	// The account gets a password nobody knows, one can be set with a reset
+	password, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	name := identity.Name
+	if name == "" {
+		name = username
+	}
+	return s.repo.RegisterWithIdentity(&entities.User{
+		Name:          name,
+		Username:      username,
+		Email:         identity.Email,
+		Password:      hash,
+		ProfileImgUrl: entities.DefaultProfileImgUrl,
+		Verified:      true,
+	}, link)
+}
+
 func (s *service) GetRepo() Repository {
 	return s.repo
 }
@@ -155,3 +760,33 @@ func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Recovery codes look like 4f2ka-9xq7m so they are easy to type
+func newRecoveryCode() (string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 11)
+	for i, c := range b {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, alphabet[int(c)%len(alphabet)])
+	}
+	return string(code), nil
+}
@@ -0,0 +1,45 @@
+package user
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// Failed logins allowed before backing off, per account and per IP. An IP
+	// gets more as many users can share one behind a NAT.
+	accountFreeAttempts = 5
+	ipFreeAttempts      = 20
+
+	lockoutBase   = 30 * time.Second
+	lockoutMax    = time.Hour
+	failureWindow = 24 * time.Hour
+)
+
+func emailThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// backoff locks for lockoutBase once a failure comes after the free attempts
+// are used up and doubles the lock with every further failure, up to
+// lockoutMax.
+func backoff(freeAttempts int) func(failures int) time.Duration {
+	return func(failures int) time.Duration {
+		over := failures - freeAttempts - 1
+		if over < 0 {
+			return 0
+		}
+		if over > 16 {
+			return lockoutMax
+		}
+		lock := lockoutBase << uint(over)
+		if lock > lockoutMax {
+			return lockoutMax
+		}
+		return lock
+	}
+}
@@ -0,0 +1,63 @@
+package user
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/oidc"
+	"math/big"
+	"strings"
+)
+
+const (
+	// Leaves room for the numeric suffix added when the name is taken
+	maxUsernameBase   = 15
+	minUsernameLength = 3
+	usernameAttempts  = 10
+)
+
+// generateUsername derives a free username from what the provider told us,
+// adding a random number while the plain one is taken.
+func (s *service) generateUsername(identity *oidc.Identity) (string, error) {
+	base := usernameBase(identity)
+	username := base
+	for i := 0; i < usernameAttempts; i++ {
+		exist, err := s.DoesUsernameExist(username)
+		if err != nil {
+			return "", err
+		}
+		if !exist {
+			return username, nil
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		username = fmt.Sprintf("%s%04d", base, n.Int64())
+	}
+	return "", pkg.ErrExists
+}
+
+func usernameBase(identity *oidc.Identity) string {
+	candidates := []string{
+		identity.PreferredUsername,
+		strings.SplitN(identity.Email, "@", 2)[0],
+		identity.Name,
+	}
+	for _, candidate := range candidates {
+		var b strings.Builder
+		for _, c := range strings.ToLower(candidate) {
+			if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' || c == '.' {
+				b.WriteRune(c)
+			}
+		}
+		base := strings.Trim(b.String(), "._")
+		if len(base) > maxUsernameBase {
+			base = base[:maxUsernameBase]
+		}
+		if len(base) >= minUsernameLength {
+			return base
+		}
+	}
+	return "cook"
+}
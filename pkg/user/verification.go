@@ -0,0 +1,88 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/rithikjain/SocialRecipe/pkg"
+	"github.com/rithikjain/SocialRecipe/pkg/entities"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	verificationTTL            = 48 * time.Hour
+	verificationResendInterval = 2 * time.Minute
+
+	// Shortest secret verification links are signed with, 32 bytes like the
+	// output of the HMAC
+	minVerificationSecret = 32
+)
+
+var verificationSecret []byte
+
+// SetVerificationSecret sets the key verification links are signed with. It
+// has to be called once at startup, before any link is signed or checked.
+func SetVerificationSecret(secret string) error {
+	if len(secret) < minVerificationSecret {
+		return fmt.Errorf("verification secret must be at least %d bytes", minVerificationSecret)
+	}
+	verificationSecret = []byte(secret)
+	return nil
+}
+
+// CheckVerified enforces the requireVerifiedEmail policy: when it is turned on
+// users have to confirm their email before they can post or follow.
+func CheckVerified(user *entities.User) error {
+	if os.Getenv("requireVerifiedEmail") == "true" && !user.Verified {
+		return pkg.ErrNotVerified
+	}
+	return nil
+}
+
+// NewVerificationToken signs the user id and email together so a link stops
+// working once the user changes their email.
+func NewVerificationToken(user *entities.User, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%d:%d:%s", user.ID, expiresAt.Unix(), user.Email)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(encoded))
+}
+
+// ParseVerificationToken returns the user id and email a token was issued for.
+func ParseVerificationToken(token string) (uint, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return 0, "", pkg.ErrVerifyToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(mac, sign(parts[0])) {
+		return 0, "", pkg.ErrVerifyToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return 0, "", pkg.ErrVerifyToken
+	}
+
+	fields := strings.SplitN(string(payload), ":", 3)
+	if len(fields) != 3 {
+		return 0, "", pkg.ErrVerifyToken
+	}
+	id, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return 0, "", pkg.ErrVerifyToken
+	}
+	exp, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return 0, "", pkg.ErrVerifyToken
+	}
+	return uint(id), fields[2], nil
+}
+
+func sign(payload string) []byte {
+	mac := hmac.New(sha256.New, verificationSecret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}